@@ -0,0 +1,295 @@
+// Package mwamqp instruments RabbitMQ publishers and consumers of
+// rabbitmq/amqp091-go with the providers and propagators configured by
+// tracker.Track.
+package mwamqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/middleware-labs/golang-apm/mwamqp"
+
+// system is the messaging.system of every span and metric.
+const system = "rabbitmq"
+
+// ErrNacked is returned by Publisher.Publish with WithConfirmWait when the
+// broker rejects a message on a channel in confirm mode.
+var ErrNacked = errors.New("mwamqp: message nacked by the broker")
+
+// Channel is the part of *amqp.Channel used by this package, so that a fake
+// can be used in tests.
+type Channel interface {
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error)
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+}
+
+type config struct {
+	attributes     []attribute.KeyValue
+	waitForConfirm bool
+}
+
+type Option interface {
+	apply(config) config
+}
+
+type optFunc func(config) config
+
+func (f optFunc) apply(c config) config { return f(c) }
+
+// WithAttributes adds attributes to every span.
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return optFunc(func(c config) config {
+		c.attributes = append(c.attributes, attributes...)
+		return c
+	})
+}
+
+// WithConfirmWait makes Publisher.Publish wait for the broker to confirm
+// each message on a channel in confirm mode, and return ErrNacked if it is
+// rejected.
+func WithConfirmWait() Option {
+	return optFunc(func(c config) config {
+		c.waitForConfirm = true
+		return c
+	})
+}
+
+func newConfig(options []Option) config {
+	var c config
+	for _, opt := range options {
+		c = opt.apply(c)
+	}
+	return c
+}
+
+// Publisher publishes messages with a producer span, injecting its context
+// into the message headers.
+type Publisher struct {
+	ch Channel
+	c  config
+}
+
+// NewPublisher returns a publisher on ch, usually an *amqp.Channel.
+//
+//	ch.Confirm(false)
+//	p := mwamqp.NewPublisher(ch)
+//	err := p.Publish(ctx, "orders", "created", false, false, amqp.Publishing{Body: order})
+func NewPublisher(ch Channel, opts ...Option) *Publisher {
+	return &Publisher{ch: ch, c: newConfig(opts)}
+}
+
+// Publish publishes msg like amqp.Channel.PublishWithContext. When ch is in
+// confirm mode, the confirm latency is recorded once the broker confirms the
+// message, without waiting for it unless WithConfirmWait is set. The headers
+// of msg are copied, not modified.
+func (p *Publisher) Publish(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	headers := make(amqp.Table, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	msg.Headers = headers
+
+	destination := destinationName(exchange, key)
+	attributes := append([]attribute.KeyValue{
+		attribute.String("messaging.rabbitmq.destination.routing_key", key),
+		attribute.Int("messaging.message.body.size", len(msg.Body)),
+	}, p.c.attributes...)
+	if msg.MessageId != "" {
+		attributes = append(attributes, attribute.String("messaging.message.id", msg.MessageId))
+	}
+	ctx, span := tracker.StartProducerSpan(ctx, system, destination, tableCarrier(headers),
+		trace.WithAttributes(attributes...))
+
+	confirmation, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if err == nil && confirmation != nil {
+		start := time.Now()
+		if p.c.waitForConfirm {
+			var acked bool
+			acked, err = confirmation.WaitContext(ctx)
+			recordConfirm(ctx, destination, start, acked)
+			if err == nil && !acked {
+				err = ErrNacked
+			}
+		} else {
+			// Closing the channel nacks outstanding confirmations, so
+			// the goroutine always ends.
+			ctx := context.WithoutCancel(ctx)
+			go func() {
+				<-confirmation.Done()
+				recordConfirm(ctx, destination, start, confirmation.Acked())
+			}()
+		}
+	}
+	finishSpan(span, err)
+	return err
+}
+
+func recordConfirm(ctx context.Context, destination string, start time.Time, acked bool) {
+	instrumentsFor().confirm.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", destination),
+		attribute.Bool("messaging.rabbitmq.acked", acked),
+	))
+}
+
+// Get pulls a message from queue like amqp.Channel.Get, with a receive span
+// linked to the producer span of the message. Redeliveries are counted by
+// Process.
+func Get(ctx context.Context, ch Channel, queue string, autoAck bool, opts ...Option) (amqp.Delivery, bool, error) {
+	c := newConfig(opts)
+	_, span := tracker.StartReceiveSpan(ctx, system, queue, trace.WithAttributes(c.attributes...))
+	d, ok, err := ch.Get(queue, autoAck)
+	if ok {
+		tracker.AddProducerLink(span, tableCarrier(d.Headers))
+		span.SetAttributes(deliveryAttributes(d)...)
+	}
+	finishSpan(span, err)
+	return d, ok, err
+}
+
+// Process calls fn with a consumer span for d, a child of the producer span,
+// and records the processing duration and whether d is a redelivery.
+//
+//	for d := range deliveries {
+//		err := mwamqp.Process(ctx, d, func(ctx context.Context) error {
+//			return handle(ctx, d)
+//		})
+//		...
+//	}
+func Process(ctx context.Context, d amqp.Delivery, fn func(context.Context) error, opts ...Option) error {
+	c := newConfig(opts)
+	start := time.Now()
+	destination := destinationName(d.Exchange, d.RoutingKey)
+	recordRedelivery(ctx, d)
+	ctx, span := tracker.StartConsumerSpan(ctx, system, destination, tableCarrier(d.Headers),
+		trace.WithAttributes(deliveryAttributes(d)...),
+		trace.WithAttributes(c.attributes...))
+	err := fn(ctx)
+	finishSpan(span, err)
+	instrumentsFor().duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", destination),
+		attribute.String("messaging.operation.type", "process"),
+	))
+	return err
+}
+
+// destinationName is the exchange, or the routing key, which names the
+// queue, for the default exchange.
+func destinationName(exchange, key string) string {
+	if exchange == "" {
+		return key
+	}
+	return exchange
+}
+
+func deliveryAttributes(d amqp.Delivery) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("messaging.rabbitmq.destination.routing_key", d.RoutingKey),
+		attribute.Int64("messaging.rabbitmq.message.delivery_tag", int64(d.DeliveryTag)),
+		attribute.Bool("messaging.rabbitmq.message.redelivered", d.Redelivered),
+		attribute.Int("messaging.message.body.size", len(d.Body)),
+	}
+	if d.MessageId != "" {
+		attributes = append(attributes, attribute.String("messaging.message.id", d.MessageId))
+	}
+	if d.ConsumerTag != "" {
+		attributes = append(attributes, attribute.String("messaging.rabbitmq.consumer_tag", d.ConsumerTag))
+	}
+	// Quorum queues count deliveries in the x-delivery-count header.
+	if count, ok := d.Headers["x-delivery-count"].(int64); ok {
+		attributes = append(attributes, attribute.Int64("messaging.rabbitmq.message.delivery_count", count))
+	}
+	return attributes
+}
+
+func recordRedelivery(ctx context.Context, d amqp.Delivery) {
+	if !d.Redelivered {
+		return
+	}
+	instrumentsFor().redeliveries.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", destinationName(d.Exchange, d.RoutingKey)),
+	))
+}
+
+func finishSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// tableCarrier adapts AMQP headers for propagation.
+type tableCarrier amqp.Table
+
+func (t tableCarrier) Get(key string) string {
+	switch v := t[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (t tableCarrier) Set(key, value string) {
+	if t != nil {
+		t[key] = value
+	}
+}
+
+func (t tableCarrier) Keys() []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// instruments are the RabbitMQ metrics of one meter provider.
+type instruments struct {
+	confirm      metric.Float64Histogram
+	duration     metric.Float64Histogram
+	redeliveries metric.Int64Counter
+}
+
+var instrumentsCache sync.Map // metric.MeterProvider -> *instruments
+
+// instrumentsFor returns the instruments of the tracker's meter provider.
+// They are created again once the tracker's meter provider replaces the
+// global one.
+func instrumentsFor() *instruments {
+	mp := tracker.ActiveMeterProvider()
+	if i, ok := instrumentsCache.Load(mp); ok {
+		return i.(*instruments)
+	}
+	meter := mp.Meter(instrumentationName)
+	var i instruments
+	i.confirm, _ = meter.Float64Histogram("messaging.rabbitmq.publish.confirm.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time taken by the broker to confirm a published message."))
+	i.duration, _ = meter.Float64Histogram("messaging.process.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of processing a message."))
+	i.redeliveries, _ = meter.Int64Counter("messaging.rabbitmq.redeliveries",
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of messages delivered again after a failed or unacknowledged delivery."))
+	actual, _ := instrumentsCache.LoadOrStore(mp, &i)
+	return actual.(*instruments)
+}
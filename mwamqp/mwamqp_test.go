@@ -0,0 +1,137 @@
+package mwamqp
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeChannel records published messages and hands them out on Get.
+type fakeChannel struct {
+	published []amqp.Publishing
+	queue     []amqp.Delivery
+}
+
+func (ch *fakeChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	ch.published = append(ch.published, msg)
+	ch.queue = append(ch.queue, amqp.Delivery{
+		Exchange:    exchange,
+		RoutingKey:  key,
+		Headers:     msg.Headers,
+		Body:        msg.Body,
+		DeliveryTag: uint64(len(ch.published)),
+		Redelivered: true,
+	})
+	// Not in confirm mode.
+	return nil, nil
+}
+
+func (ch *fakeChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	if len(ch.queue) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+	d := ch.queue[0]
+	ch.queue = ch.queue[1:]
+	return d, true, nil
+}
+
+// withTestProviders installs providers recording spans and metrics, and the
+// W3C trace context propagator, until the end of the test.
+func withTestProviders(t *testing.T) (*tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	previousTp, previousMp, previousPropagator := otel.GetTracerProvider(), otel.GetMeterProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousTp)
+		otel.SetMeterProvider(previousMp)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter, reader
+}
+
+// counterValue returns the sum of the data points of an int64 counter.
+func counterValue(t *testing.T, reader *sdkmetric.ManualReader, name string) int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == name {
+				for _, dp := range sum.DataPoints {
+					total += dp.Value
+				}
+			}
+		}
+	}
+	return total
+}
+
+func TestPublishCopiesHeaders(t *testing.T) {
+	withTestProviders(t)
+	ch := &fakeChannel{}
+	headers := amqp.Table{"source": "test"}
+	err := NewPublisher(ch).Publish(context.Background(), "orders", "created", false, false, amqp.Publishing{Headers: headers, Body: []byte("order")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 {
+		t.Errorf("headers of the message were modified: %v", headers)
+	}
+	published := ch.published[0].Headers
+	if published["source"] != "test" || published["traceparent"] == nil {
+		t.Errorf("published headers = %v, want source and traceparent", published)
+	}
+}
+
+func TestGetAndProcess(t *testing.T) {
+	exporter, reader := withTestProviders(t)
+	ch := &fakeChannel{}
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	if err := NewPublisher(ch).Publish(ctx, "", "orders", false, false, amqp.Publishing{Body: []byte("order")}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	d, ok, err := Get(context.Background(), ch, "orders", false)
+	if err != nil || !ok {
+		t.Fatalf("Get = %v, %v", ok, err)
+	}
+	if got := counterValue(t, reader, "messaging.rabbitmq.redeliveries"); got != 0 {
+		t.Errorf("Get counted %d redeliveries, want 0", got)
+	}
+	var processCtx context.Context
+	if err := Process(context.Background(), d, func(ctx context.Context) error {
+		processCtx = ctx
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := counterValue(t, reader, "messaging.rabbitmq.redeliveries"); got != 1 {
+		t.Errorf("counted %d redeliveries, want 1", got)
+	}
+	if trace.SpanContextFromContext(processCtx).TraceID() != parent.SpanContext().TraceID() {
+		t.Error("process span does not continue the producer's trace")
+	}
+	if _, ok, _ := Get(context.Background(), ch, "orders", false); ok {
+		t.Error("Get returned a message from an empty queue")
+	}
+
+	if got := len(exporter.GetSpans()); got != 5 {
+		t.Errorf("got %d spans, want the producer, parent, 2 receive and process spans", got)
+	}
+}
@@ -0,0 +1,171 @@
+package mwgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor returns an interceptor that creates a client span
+// for each unary call, propagates its context in the call metadata and
+// records the rpc.client.* metrics.
+//
+//	grpc.NewClient(target,
+//		grpc.WithUnaryInterceptor(mwgrpc.UnaryClientInterceptor(cfg)),
+//		grpc.WithStreamInterceptor(mwgrpc.StreamClientInterceptor(cfg)),
+//	)
+func UnaryClientInterceptor(cfg *tracker.Config, opts ...Option) grpc.UnaryClientInterceptor {
+	c := newConfig(cfg, opts)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		if !c.instrumented(method) {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		start := time.Now()
+		ctx, span := c.startClientSpan(ctx, method, cc)
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		var responses int64
+		if err == nil {
+			responses = 1
+		}
+		finishCall(ctx, span, rpcInstrumentsFor("client"), method, err, start, 1, responses, false)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that creates a client span
+// for each streaming call. The span ends when the stream is finished: once
+// the server closed it, after the single response of a client-streaming
+// call, or when the context of the call is done. As with any gRPC stream,
+// callers that stop reading early must cancel the context.
+func StreamClientInterceptor(cfg *tracker.Config, opts ...Option) grpc.StreamClientInterceptor {
+	c := newConfig(cfg, opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !c.instrumented(method) {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+		start := time.Now()
+		ctx, span := c.startClientSpan(ctx, method, cc)
+		cs, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			finishCall(ctx, span, rpcInstrumentsFor("client"), method, err, start, 0, 0, false)
+			return cs, err
+		}
+		stream := &clientStream{ClientStream: cs, serverStreams: desc.ServerStreams, done: make(chan struct{})}
+		stream.finish = func(err error) {
+			finishCall(ctx, span, rpcInstrumentsFor("client"), method, err, start, stream.sent.Load(), stream.received.Load(), false)
+		}
+		// A stream abandoned by cancelling its context is never read to the
+		// end, so end the span when the context is done.
+		go func() {
+			select {
+			case <-ctx.Done():
+				stream.end(status.FromContextError(ctx.Err()).Err())
+			case <-stream.done:
+			}
+		}()
+		return stream, nil
+	}
+}
+
+func (c config) startClientSpan(ctx context.Context, method string, cc *grpc.ClientConn) (context.Context, trace.Span) {
+	attributes := methodAttributes(method)
+	if cc != nil {
+		attributes = append(attributes, targetAttributes(cc.Target())...)
+	}
+	ctx, span := c.tracer().Start(ctx, spanName(method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	c.textMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// targetAttributes returns server.address and server.port from a dial
+// target such as "dns:///orders:50051" or "localhost:50051".
+func targetAttributes(target string) []attribute.KeyValue {
+	if i := strings.LastIndex(target, "/"); i >= 0 {
+		target = target[i+1:]
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return []attribute.KeyValue{attribute.String("server.address", target)}
+	}
+	attributes := []attribute.KeyValue{attribute.String("server.address", host)}
+	if n, err := strconv.Atoi(port); err == nil {
+		attributes = append(attributes, attribute.Int("server.port", n))
+	}
+	return attributes
+}
+
+// clientStream counts messages and finishes the call when the stream ends.
+type clientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	received      atomic.Int64
+	sent          atomic.Int64
+	once          sync.Once
+	done          chan struct{}
+	finish        func(error)
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	} else if !errors.Is(err, io.EOF) {
+		// io.EOF means the stream ended; the status is returned by RecvMsg.
+		s.end(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.received.Add(1)
+		if !s.serverStreams {
+			s.end(nil)
+		}
+	case errors.Is(err, io.EOF):
+		s.end(nil)
+	default:
+		s.end(err)
+	}
+	return err
+}
+
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.end(err)
+	}
+	return md, err
+}
+
+func (s *clientStream) end(err error) {
+	s.once.Do(func() {
+		s.finish(err)
+		close(s.done)
+	})
+}
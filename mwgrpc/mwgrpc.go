@@ -0,0 +1,206 @@
+// Package mwgrpc instruments gRPC clients and servers with the providers
+// and propagators configured by tracker.Track.
+package mwgrpc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const instrumentationName = "github.com/middleware-labs/golang-apm/mwgrpc"
+
+// healthCheckPrefix is the method prefix of the standard health service.
+const healthCheckPrefix = "/grpc.health.v1.Health/"
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	filters        []func(fullMethod string) bool
+}
+
+type Option interface {
+	apply(config) config
+}
+
+type optFunc func(config) config
+
+func (f optFunc) apply(c config) config { return f(c) }
+
+// WithFilter skips instrumentation of calls for which filter returns false.
+// fullMethod has the form "/package.Service/Method".
+func WithFilter(filter func(fullMethod string) bool) Option {
+	return optFunc(func(c config) config {
+		c.filters = append(c.filters, filter)
+		return c
+	})
+}
+
+// WithoutHealthCheck skips instrumentation of the grpc.health.v1.Health
+// service.
+func WithoutHealthCheck() Option {
+	return WithFilter(func(fullMethod string) bool {
+		return !strings.HasPrefix(fullMethod, healthCheckPrefix)
+	})
+}
+
+func newConfig(cfg *tracker.Config, options []Option) config {
+	var c config
+	for _, opt := range options {
+		c = opt.apply(c)
+	}
+
+	// Without a config the tracker's providers are looked up for each call,
+	// so that interceptors created before Track still report.
+	if cfg != nil && cfg.Tp != nil {
+		c.tracerProvider = cfg.Tp
+	}
+	if cfg != nil && cfg.Propagator() != nil {
+		c.propagator = cfg.Propagator()
+	}
+
+	return c
+}
+
+func (c config) instrumented(fullMethod string) bool {
+	for _, f := range c.filters {
+		if !f(fullMethod) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c config) tracer() trace.Tracer {
+	if c.tracerProvider != nil {
+		return c.tracerProvider.Tracer(instrumentationName)
+	}
+	return tracker.ActiveTracerProvider().Tracer(instrumentationName)
+}
+
+func (c config) textMapPropagator() propagation.TextMapPropagator {
+	if c.propagator != nil {
+		return c.propagator
+	}
+	return tracker.ActivePropagator()
+}
+
+// metadataCarrier adapts gRPC metadata for propagation.
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	if values := metadata.MD(m).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// spanName turns "/package.Service/Method" into "package.Service/Method".
+func spanName(fullMethod string) string {
+	return strings.TrimPrefix(fullMethod, "/")
+}
+
+// methodAttributes returns the rpc.* attributes identifying fullMethod.
+func methodAttributes(fullMethod string) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.String("rpc.system", "grpc")}
+	service, method, ok := strings.Cut(spanName(fullMethod), "/")
+	if !ok {
+		return append(attributes, attribute.String("rpc.method", fullMethod))
+	}
+	return append(attributes,
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+	)
+}
+
+// serverErrorCodes are the codes that mark a server span as failed; the
+// others are the client's fault.
+var serverErrorCodes = map[grpccodes.Code]bool{
+	grpccodes.Unknown:          true,
+	grpccodes.DeadlineExceeded: true,
+	grpccodes.Unimplemented:    true,
+	grpccodes.Internal:         true,
+	grpccodes.Unavailable:      true,
+	grpccodes.DataLoss:         true,
+}
+
+// finishCall sets the status of span from err, ends it and records the call
+// metrics. requests and responses count the messages sent by the client and
+// by the server.
+func finishCall(ctx context.Context, span trace.Span, instruments *rpcInstruments, fullMethod string, err error, start time.Time, requests, responses int64, server bool) {
+	s, _ := status.FromError(err)
+	code := s.Code()
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if code != grpccodes.OK && (!server || serverErrorCodes[code]) {
+		span.SetStatus(codes.Error, s.Message())
+		span.RecordError(err)
+	}
+	span.End()
+
+	measurement := metric.WithAttributes(append(methodAttributes(fullMethod),
+		attribute.Int("rpc.grpc.status_code", int(code)))...)
+	instruments.duration.Record(ctx, float64(time.Since(start))/float64(time.Millisecond), measurement)
+	instruments.requests.Record(ctx, requests, measurement)
+	instruments.responses.Record(ctx, responses, measurement)
+}
+
+// rpcInstruments are the RPC metrics of the semantic conventions for one
+// side of a call.
+type rpcInstruments struct {
+	duration  metric.Float64Histogram
+	requests  metric.Int64Histogram
+	responses metric.Int64Histogram
+}
+
+var rpcInstrumentsCache sync.Map // rpcInstrumentsKey -> *rpcInstruments
+
+type rpcInstrumentsKey struct {
+	provider metric.MeterProvider
+	side     string
+}
+
+// rpcInstrumentsFor returns the instruments of the tracker's meter provider
+// for side, "server" or "client". They are created again once the tracker's
+// meter provider replaces the global one.
+func rpcInstrumentsFor(side string) *rpcInstruments {
+	key := rpcInstrumentsKey{tracker.ActiveMeterProvider(), side}
+	if i, ok := rpcInstrumentsCache.Load(key); ok {
+		return i.(*rpcInstruments)
+	}
+	meter := key.provider.Meter(instrumentationName)
+	var i rpcInstruments
+	i.duration, _ = meter.Float64Histogram("rpc."+side+".duration",
+		metric.WithUnit("ms"),
+		metric.WithDescription("Duration of gRPC calls."))
+	i.requests, _ = meter.Int64Histogram("rpc."+side+".requests_per_rpc",
+		metric.WithUnit("{count}"),
+		metric.WithDescription("Number of messages received per call on the server, sent on the client."))
+	i.responses, _ = meter.Int64Histogram("rpc."+side+".responses_per_rpc",
+		metric.WithUnit("{count}"),
+		metric.WithDescription("Number of messages sent per call on the server, received on the client."))
+	actual, _ := rpcInstrumentsCache.LoadOrStore(key, &i)
+	return actual.(*rpcInstruments)
+}
@@ -0,0 +1,167 @@
+package mwgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves the health service on an in-memory listener with
+// the server interceptors and returns a client with the client
+// interceptors. Spans of both sides are recorded in the returned exporter.
+func newTestClient(t *testing.T, opts ...Option) (healthpb.HealthClient, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	cfg := &tracker.Config{Tp: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(cfg, opts...)),
+		grpc.StreamInterceptor(StreamServerInterceptor(cfg, opts...)),
+	)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(cfg, opts...)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(cfg, opts...)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn), exporter
+}
+
+// waitForSpans waits until n spans have ended.
+func waitForSpans(t *testing.T, exporter *tracetest.InMemoryExporter, n int) tracetest.SpanStubs {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		spans := exporter.GetSpans()
+		if len(spans) >= n {
+			return spans
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d spans, want %d", len(spans), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func spanOfKind(t *testing.T, spans tracetest.SpanStubs, kind trace.SpanKind) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.SpanKind == kind {
+			return span
+		}
+	}
+	t.Fatalf("no %s span in %v", kind, spans)
+	return tracetest.SpanStub{}
+}
+
+func attributeValue(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestUnaryCall(t *testing.T) {
+	client, exporter := newTestClient(t)
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := waitForSpans(t, exporter, 2)
+	clientSpan := spanOfKind(t, spans, trace.SpanKindClient)
+	serverSpan := spanOfKind(t, spans, trace.SpanKindServer)
+	if serverSpan.Parent.SpanID() != clientSpan.SpanContext.SpanID() {
+		t.Errorf("server span parent = %s, want client span %s", serverSpan.Parent.SpanID(), clientSpan.SpanContext.SpanID())
+	}
+	if clientSpan.Name != "grpc.health.v1.Health/Check" {
+		t.Errorf("client span name = %q", clientSpan.Name)
+	}
+	for _, span := range spans {
+		if got := attributeValue(span, "rpc.service"); got != "grpc.health.v1.Health" {
+			t.Errorf("%s rpc.service = %q", span.SpanKind, got)
+		}
+		if got := attributeValue(span, "rpc.grpc.status_code"); got != "0" {
+			t.Errorf("%s rpc.grpc.status_code = %q, want 0", span.SpanKind, got)
+		}
+	}
+}
+
+func TestUnaryCallError(t *testing.T) {
+	client, exporter := newTestClient(t)
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != grpccodes.NotFound {
+		t.Fatalf("Check() error = %v, want NotFound", err)
+	}
+
+	spans := waitForSpans(t, exporter, 2)
+	if span := spanOfKind(t, spans, trace.SpanKindClient); span.Status.Code != codes.Error {
+		t.Errorf("client span status = %v, want Error", span.Status)
+	}
+	// NotFound is the client's fault, so the server span does not fail.
+	if span := spanOfKind(t, spans, trace.SpanKindServer); span.Status.Code == codes.Error {
+		t.Errorf("server span status = %v, want Unset", span.Status)
+	}
+}
+
+func TestStreamCancelled(t *testing.T) {
+	client, exporter := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// The stream is abandoned without being read to the end.
+	cancel()
+
+	spans := waitForSpans(t, exporter, 2)
+	clientSpan := spanOfKind(t, spans, trace.SpanKindClient)
+	if got := attributeValue(clientSpan, "rpc.grpc.status_code"); got != "1" {
+		t.Errorf("rpc.grpc.status_code = %q, want 1 (Canceled)", got)
+	}
+}
+
+func TestWithoutHealthCheck(t *testing.T) {
+	client, exporter := newTestClient(t, WithoutHealthCheck())
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("got %d spans for a filtered method", len(spans))
+	}
+}
@@ -0,0 +1,106 @@
+package mwgrpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// UnaryServerInterceptor returns an interceptor that creates a server span
+// for each unary call, continuing the trace propagated by the client in the
+// call metadata, and records the rpc.server.* metrics.
+//
+//	grpc.NewServer(
+//		grpc.UnaryInterceptor(mwgrpc.UnaryServerInterceptor(cfg, mwgrpc.WithoutHealthCheck())),
+//		grpc.StreamInterceptor(mwgrpc.StreamServerInterceptor(cfg, mwgrpc.WithoutHealthCheck())),
+//	)
+func UnaryServerInterceptor(cfg *tracker.Config, opts ...Option) grpc.UnaryServerInterceptor {
+	c := newConfig(cfg, opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !c.instrumented(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		ctx, span := c.startServerSpan(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		var responses int64
+		if err == nil {
+			responses = 1
+		}
+		finishCall(ctx, span, rpcInstrumentsFor("server"), info.FullMethod, err, start, 1, responses, true)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that creates a server span
+// for each streaming call, counting the messages received and sent.
+func StreamServerInterceptor(cfg *tracker.Config, opts ...Option) grpc.StreamServerInterceptor {
+	c := newConfig(cfg, opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !c.instrumented(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		start := time.Now()
+		ctx, span := c.startServerSpan(ss.Context(), info.FullMethod)
+		stream := &serverStream{ServerStream: ss, ctx: ctx}
+		err := handler(srv, stream)
+		finishCall(ctx, span, rpcInstrumentsFor("server"), info.FullMethod, err, start, stream.received.Load(), stream.sent.Load(), true)
+		return err
+	}
+}
+
+func (c config) startServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = c.textMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	attributes := methodAttributes(fullMethod)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, port, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			attributes = append(attributes, attribute.String("network.peer.address", host))
+			if n, err := strconv.Atoi(port); err == nil {
+				attributes = append(attributes, attribute.Int("network.peer.port", n))
+			}
+		}
+	}
+	return c.tracer().Start(ctx, spanName(fullMethod),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// serverStream hands the span context to the handler and counts messages.
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	received atomic.Int64
+	sent     atomic.Int64
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
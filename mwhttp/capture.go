@@ -0,0 +1,230 @@
+package mwhttp
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultBodyCaptureSize is the number of bytes of a body captured when
+// BodyCapture.MaxSize is not set.
+const defaultBodyCaptureSize = 4096
+
+// BodyCapture selects the request and response bodies recorded on spans.
+type BodyCapture struct {
+	// MaxSize is the number of bytes captured per body, 4096 by default.
+	// Longer bodies are truncated.
+	MaxSize int
+	// ContentTypes are the media types captured, e.g. "application/json".
+	// A type ending in "/*" matches its whole family. Defaults to
+	// "application/json". Only JSON and URL-encoded form bodies can be
+	// scrubbed, so bodies of other types are never recorded, and neither
+	// are bodies with a Content-Encoding such as gzip.
+	ContentTypes []string
+	// Routes restricts capture to the given ServeMux routes, e.g.
+	// "/users/{id}", or URL path globs, e.g. "/webhooks/*". Empty captures
+	// every route.
+	Routes []string
+}
+
+// WithRequestHeaders records the given request headers on spans as
+// http.request.header.<name> attributes.
+func WithRequestHeaders(names ...string) Option {
+	return optFunc(func(c config) config {
+		c.requestHeaders = append(c.requestHeaders, names...)
+		return c
+	})
+}
+
+// WithResponseHeaders records the given response headers on spans as
+// http.response.header.<name> attributes.
+func WithResponseHeaders(names ...string) Option {
+	return optFunc(func(c config) config {
+		c.responseHeaders = append(c.responseHeaders, names...)
+		return c
+	})
+}
+
+// WithBodyCapture records request and response bodies on spans as
+// http.request.body.content and http.response.body.content attributes.
+// JSON and form fields matching WithRedactedFields are scrubbed first.
+func WithBodyCapture(capture BodyCapture) Option {
+	return optFunc(func(c config) config {
+		if capture.MaxSize <= 0 {
+			capture.MaxSize = defaultBodyCaptureSize
+		}
+		if len(capture.ContentTypes) == 0 {
+			capture.ContentTypes = []string{"application/json"}
+		}
+		c.bodyCapture = &capture
+		return c
+	})
+}
+
+// WithRedactedHeaders adds headers whose captured values are replaced with
+// "[REDACTED]". Authorization, Proxy-Authorization, Cookie and Set-Cookie
+// are always redacted.
+func WithRedactedHeaders(names ...string) Option {
+	return optFunc(func(c config) config {
+		headers := make(map[string]bool, len(c.redactedHeaders)+len(names))
+		for name := range c.redactedHeaders {
+			headers[name] = true
+		}
+		for _, name := range names {
+			headers[http.CanonicalHeaderKey(name)] = true
+		}
+		c.redactedHeaders = headers
+		return c
+	})
+}
+
+// WithRedactedFields scrubs the values of JSON and form fields, and of query
+// parameters, whose name matches one of patterns from captured bodies and
+// URLs. Patterns are path.Match globs matched case-insensitively, e.g.
+// "password" or "*token*".
+func WithRedactedFields(patterns ...string) Option {
+	return optFunc(func(c config) config {
+		for _, p := range patterns {
+			c.redactedFields = append(c.redactedFields, strings.ToLower(p))
+		}
+		return c
+	})
+}
+
+func defaultRedactedHeaders() map[string]bool {
+	return map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	}
+}
+
+// headerAttributes returns the captured headers of h, with prefix being
+// "http.request.header" or "http.response.header".
+func (c config) headerAttributes(prefix string, h http.Header, names []string) []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+	for _, name := range names {
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if c.redactedHeaders[http.CanonicalHeaderKey(name)] {
+			values = []string{redacted}
+		}
+		attributes = append(attributes, attribute.StringSlice(prefix+"."+strings.ToLower(name), values))
+	}
+	return attributes
+}
+
+// newBodyBuffer returns a buffer capturing a body, or nil when bodies are
+// not captured.
+func (c config) newBodyBuffer() *bodyBuffer {
+	if c.bodyCapture == nil {
+		return nil
+	}
+	return &bodyBuffer{max: c.bodyCapture.MaxSize}
+}
+
+// capturesRoute reports whether bodies of requests to route, or to urlPath
+// when the route is not known, are captured.
+func (c config) capturesRoute(route, urlPath string) bool {
+	if len(c.bodyCapture.Routes) == 0 {
+		return true
+	}
+	for _, r := range c.bodyCapture.Routes {
+		if r == route || r == urlPath {
+			return true
+		}
+		if ok, _ := path.Match(r, urlPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// capturesContentType reports whether bodies of the media type in
+// contentType are captured.
+func (c config) capturesContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.bodyCapture.ContentTypes {
+		if family, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, family+"/") {
+				return true
+			}
+		} else if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyAttributes returns the captured body as key with the scrubbed content,
+// and whether it was truncated. header holds the Content-Type and
+// Content-Encoding of the body.
+func (c config) bodyAttributes(key string, b *bodyBuffer, header http.Header) []attribute.KeyValue {
+	contentType := header.Get("Content-Type")
+	if b == nil || !c.capturesContentType(contentType) || !identityEncoded(header) {
+		return nil
+	}
+	content, truncated := b.snapshot()
+	if content == "" {
+		return nil
+	}
+	content, ok := redactBody(content, contentType, c.redactedFields)
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.String(key+".content", content),
+		attribute.Bool(key+".truncated", truncated),
+	}
+}
+
+// identityEncoded reports whether a body is sent as is. Compressed bodies
+// cannot be scrubbed from their first bytes, so they are not recorded.
+func identityEncoded(header http.Header) bool {
+	for _, value := range header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			if e := strings.TrimSpace(encoding); e != "" && !strings.EqualFold(e, "identity") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bodyBuffer keeps the first max bytes of a body. A client may still be
+// sending the request body while the response is handled, so it is guarded.
+type bodyBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *bodyBuffer) write(p []byte) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.max - len(b.buf); room < len(p) {
+		p = p[:max(room, 0)]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+}
+
+func (b *bodyBuffer) snapshot() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf), b.truncated
+}
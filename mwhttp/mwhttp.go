@@ -0,0 +1,190 @@
+// Package mwhttp instruments net/http servers and clients with the
+// providers and propagators configured by tracker.Track.
+package mwhttp
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/middleware-labs/golang-apm/mwhttp"
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	filters        []func(*http.Request) bool
+	peerServices   map[string]string
+	phases         phaseMode
+	traceResponse  bool
+	debugHeader    string
+	debugSecret    string
+
+	requestHeaders  []string
+	responseHeaders []string
+	bodyCapture     *BodyCapture
+	redactedHeaders map[string]bool
+	redactedFields  []string
+}
+
+// phaseMode selects how NewTransport records the phases of a request.
+type phaseMode int
+
+const (
+	phasesNone phaseMode = iota
+	phasesEvents
+	phasesSpans
+)
+
+type Option interface {
+	apply(config) config
+}
+
+type optFunc func(config) config
+
+func (f optFunc) apply(c config) config { return f(c) }
+
+// WithFilter skips instrumentation of requests for which filter returns
+// false, e.g. health checks. Multiple filters must all return true.
+func WithFilter(filter func(*http.Request) bool) Option {
+	return optFunc(func(c config) config {
+		c.filters = append(c.filters, filter)
+		return c
+	})
+}
+
+// WithIgnoredPaths skips instrumentation of requests to the given paths,
+// e.g. "/healthz".
+func WithIgnoredPaths(paths ...string) Option {
+	return WithFilter(func(r *http.Request) bool {
+		for _, p := range paths {
+			if r.URL.Path == p {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// WithPeerServices names the services behind outbound hosts for
+// NewTransport, e.g. {"api.stripe.com": "stripe"}. A host may be given with
+// or without its port. The name is set as peer.service on client spans.
+func WithPeerServices(services map[string]string) Option {
+	return optFunc(func(c config) config {
+		c.peerServices = services
+		return c
+	})
+}
+
+// WithPhaseEvents makes NewTransport add events to client spans for the DNS
+// lookup, connect, TLS handshake and time to first byte of a request.
+func WithPhaseEvents() Option {
+	return optFunc(func(c config) config {
+		c.phases = phasesEvents
+		return c
+	})
+}
+
+// WithPhaseSpans makes NewTransport create child spans of client spans for
+// the DNS lookup, connect, TLS handshake and time to first byte of a
+// request.
+func WithPhaseSpans() Option {
+	return optFunc(func(c config) config {
+		c.phases = phasesSpans
+		return c
+	})
+}
+
+// WithTraceResponseHeader makes Middleware return the trace and span IDs of
+// sampled requests in the traceresponse and Server-Timing headers, so that
+// support can look a request up from what the client received.
+func WithTraceResponseHeader() Option {
+	return optFunc(func(c config) config {
+		c.traceResponse = true
+		return c
+	})
+}
+
+// WithDebugHeader makes Middleware force sampling and debug log export for
+// requests whose header name, e.g. "X-MW-Debug", carries secret. It has no
+// effect with an empty secret.
+func WithDebugHeader(name, secret string) Option {
+	return optFunc(func(c config) config {
+		c.debugHeader = name
+		c.debugSecret = secret
+		return c
+	})
+}
+
+func newConfig(cfg *tracker.Config, options []Option) config {
+	c := config{redactedHeaders: defaultRedactedHeaders()}
+	for _, opt := range options {
+		c = opt.apply(c)
+	}
+
+	// Without a config the tracker's providers are looked up for each
+	// request, so that instrumentation created before Track still reports.
+	if cfg != nil && cfg.Tp != nil {
+		c.tracerProvider = cfg.Tp
+	}
+	if cfg != nil && cfg.Propagator() != nil {
+		c.propagator = cfg.Propagator()
+	}
+
+	return c
+}
+
+func (c config) instrumented(r *http.Request) bool {
+	for _, f := range c.filters {
+		if !f(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c config) tracer() trace.Tracer {
+	if c.tracerProvider != nil {
+		return c.tracerProvider.Tracer(instrumentationName)
+	}
+	return tracker.ActiveTracerProvider().Tracer(instrumentationName)
+}
+
+func (c config) textMapPropagator() propagation.TextMapPropagator {
+	if c.propagator != nil {
+		return c.propagator
+	}
+	return tracker.ActivePropagator()
+}
+
+// routeOf returns the path of a ServeMux pattern such as
+// "GET example.com/users/{id}", without its method and host.
+func routeOf(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i+1:], " \t")
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
+// muxPattern returns the pattern of the mux route that r matches, when next
+// is a ServeMux.
+func muxPattern(next http.Handler, r *http.Request) string {
+	if mux, ok := next.(*http.ServeMux); ok {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+	return ""
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,11 @@
+//go:build go1.23
+
+package mwhttp
+
+import "net/http"
+
+// requestPattern returns the ServeMux pattern that matched r, which the mux
+// sets on the request it routes.
+func requestPattern(_ http.Handler, r *http.Request) string {
+	return r.Pattern
+}
@@ -0,0 +1,12 @@
+//go:build !go1.23
+
+package mwhttp
+
+import "net/http"
+
+// requestPattern returns the ServeMux pattern that matched r. Before Go 1.23
+// the request does not carry it, so it is only known when the middleware
+// wraps the mux directly.
+func requestPattern(next http.Handler, r *http.Request) string {
+	return muxPattern(next, r)
+}
@@ -0,0 +1,208 @@
+package mwhttp
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// redacted replaces the values of redacted headers and fields.
+const redacted = "[REDACTED]"
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isForm(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// redactBody scrubs a captured body of contentType, reporting false for
+// content types that cannot be scrubbed and so must not be recorded.
+func redactBody(content, contentType string, patterns []string) (string, bool) {
+	switch {
+	case isJSON(contentType):
+		return redactJSONFields(content, patterns), true
+	case isForm(contentType):
+		return redactFormFields(content, patterns), true
+	}
+	return "", false
+}
+
+// redactFormFields replaces the values of URL-encoded form fields whose name
+// matches one of patterns with "[REDACTED]".
+func redactFormFields(s string, patterns []string) string {
+	if len(patterns) == 0 {
+		return s
+	}
+	fields := strings.Split(s, "&")
+	for i, field := range fields {
+		key, _, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if matchesName(name, patterns) {
+			fields[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(fields, "&")
+}
+
+// redactJSONFields replaces the values of object fields whose name matches
+// one of patterns with "[REDACTED]". It scans the text rather than decoding
+// it so that truncated bodies are scrubbed too and the rest of the document
+// is kept as sent. An object or array value is replaced as a whole.
+func redactJSONFields(s string, patterns []string) string {
+	if len(patterns) == 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		if s[i] != '"' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		end := stringEnd(s, i)
+		b.WriteString(s[i:end])
+		colon := skipSpace(s, end)
+		if colon < len(s) && s[colon] == ':' && matchesField(s[i:end], patterns) {
+			value := skipSpace(s, colon+1)
+			b.WriteString(s[end:value])
+			b.WriteString(strconv.Quote(redacted))
+			end = valueEnd(s, value)
+		}
+		i = end
+	}
+	return b.String()
+}
+
+func matchesField(quoted string, patterns []string) bool {
+	name, err := strconv.Unquote(quoted)
+	if err != nil {
+		name = strings.Trim(quoted, `"`)
+	}
+	return matchesName(name, patterns)
+}
+
+// matchesName reports whether name matches one of the lower-case patterns,
+// ignoring case.
+func matchesName(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedQueryParams are query parameters whose values are never recorded:
+// the signed URL parameters named by the semantic conventions and common
+// names of credentials.
+var redactedQueryParams = []string{
+	"awsaccesskeyid",
+	"signature",
+	"sig",
+	"x-goog-signature",
+	"x-amz-signature",
+	"x-amz-credential",
+	"x-amz-security-token",
+	"*token*",
+	"api_key",
+	"apikey",
+	"access_key",
+	"*_key",
+	"*secret*",
+	"*password*",
+	"passwd",
+	"auth",
+	"authorization",
+}
+
+// redactQuery replaces the values of query parameters matching
+// redactedQueryParams or one of patterns with "[REDACTED]", keeping the rest
+// of the query as sent.
+func redactQuery(rawQuery string, patterns []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key, _, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if matchesName(name, redactedQueryParams) || matchesName(name, patterns) {
+			params[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// stringEnd returns the index after the string starting at s[i], or len(s)
+// when it is not terminated.
+func stringEnd(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && strings.IndexByte(" \t\r\n", s[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// valueEnd returns the index after the value starting at s[i].
+func valueEnd(s string, i int) int {
+	if i >= len(s) {
+		return i
+	}
+	switch s[i] {
+	case '"':
+		return stringEnd(s, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(s); j++ {
+			switch s[j] {
+			case '"':
+				j = stringEnd(s, j) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return len(s)
+	}
+	for j := i; j < len(s); j++ {
+		if strings.IndexByte(",}] \t\r\n", s[j]) >= 0 {
+			return j
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,50 @@
+package mwhttp
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		patterns []string
+		want     string
+	}{
+		{"", nil, ""},
+		{"page=2&sort=name", nil, "page=2&sort=name"},
+		{"api_key=abc&token=def&page=2", nil, "api_key=[REDACTED]&token=[REDACTED]&page=2"},
+		{"X-Amz-Signature=abc&X-Amz-Credential=def&X-Amz-Date=20240101", nil,
+			"X-Amz-Signature=[REDACTED]&X-Amz-Credential=[REDACTED]&X-Amz-Date=20240101"},
+		{"sig=abc&flag&access%5Ftoken=def", nil, "sig=[REDACTED]&flag&access%5Ftoken=[REDACTED]"},
+		{"ssn=123&name=ann", []string{"ssn"}, "ssn=[REDACTED]&name=ann"},
+		{"apikey=a&access_key=b&stripe_key=c&API_KEY=d", nil, "apikey=[REDACTED]&access_key=[REDACTED]&stripe_key=[REDACTED]&API_KEY=[REDACTED]"},
+		{"keyword=shoes&monkey=1&keys=a,b&key_id=7", nil, "keyword=shoes&monkey=1&keys=a,b&key_id=7"},
+	}
+	for _, tt := range tests {
+		if got := redactQuery(tt.query, tt.patterns); got != tt.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	patterns := []string{"password", "*token*"}
+	tests := []struct {
+		contentType, content string
+		want                 string
+		ok                   bool
+	}{
+		{"application/json", `{"user":"ann","password":"hunter2","nested":{"access_token":"abc"}}`,
+			`{"user":"ann","password":"[REDACTED]","nested":{"access_token":"[REDACTED]"}}`, true},
+		{"application/json; charset=utf-8", `{"password":"hun`, `{"password":"[REDACTED]"`, true},
+		{"application/vnd.api+json", `{"token": 1}`, `{"token": "[REDACTED]"}`, true},
+		{"application/x-www-form-urlencoded", "user=ann&password=hunter2&csrf%5Ftoken=abc",
+			"user=ann&password=[REDACTED]&csrf%5Ftoken=[REDACTED]", true},
+		{"text/plain", "password=hunter2", "", false},
+		{"application/xml", "<password>hunter2</password>", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := redactBody(tt.content, tt.contentType, patterns)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("redactBody(%q, %q) = %q, %v, want %q, %v", tt.content, tt.contentType, got, ok, tt.want, tt.ok)
+		}
+	}
+}
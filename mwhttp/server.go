@@ -0,0 +1,278 @@
+package mwhttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware returns a middleware that creates a server span for each
+// request, continuing the trace propagated by the caller, and records the
+// request duration, active requests and body sizes.
+//
+//	mux := http.NewServeMux()
+//	mux.HandleFunc("GET /users/{id}", getUser)
+//	http.ListenAndServe(":8080", mwhttp.Middleware(cfg)(mux))
+//
+// Spans are named after the ServeMux route pattern, e.g.
+// "GET /users/{id}", or the method alone when the request matched no
+// pattern, so that span names stay low-cardinality. 5xx responses mark the
+// span as failed.
+func Middleware(cfg *tracker.Config, opts ...Option) func(http.Handler) http.Handler {
+	c := newConfig(cfg, opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !c.instrumented(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			instruments := serverInstrumentsFor(tracker.ActiveMeterProvider())
+
+			activeAttributes := metric.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.scheme", scheme(r)),
+			)
+			instruments.active.Add(r.Context(), 1, activeAttributes)
+			defer instruments.active.Add(r.Context(), -1, activeAttributes)
+
+			ctx := c.textMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			if c.debugRequested(r) {
+				ctx = tracker.WithDebug(ctx)
+			}
+			ctx, span := c.tracer().Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(c.serverRequestAttributes(r)...),
+				trace.WithAttributes(c.headerAttributes("http.request.header", r.Header, c.requestHeaders)...),
+			)
+			defer span.End()
+			if c.traceResponse {
+				setTraceResponseHeaders(ctx, w.Header())
+			}
+
+			body := &countingReader{ReadCloser: r.Body, capture: c.newBodyBuffer()}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK, capture: c.newBodyBuffer()}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(rw, r)
+
+			var (
+				attributes []attribute.KeyValue
+				route      string
+			)
+			if pattern := requestPattern(next, r); pattern != "" {
+				route = routeOf(pattern)
+				span.SetName(r.Method + " " + route)
+				attributes = append(attributes, attribute.String("http.route", route))
+			}
+			attributes = append(attributes,
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.scheme", scheme(r)),
+				attribute.Int("http.response.status_code", rw.status),
+				attribute.String("network.protocol.version", protocolVersion(r.ProtoMajor, r.ProtoMinor)),
+			)
+			if rw.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rw.status))
+				attributes = append(attributes, attribute.String("error.type", strconv.Itoa(rw.status)))
+			}
+
+			requestSize := r.ContentLength
+			if requestSize < 0 {
+				requestSize = body.n.Load()
+			}
+			span.SetAttributes(attributes...)
+			span.SetAttributes(
+				attribute.Int64("http.request.body.size", requestSize),
+				attribute.Int64("http.response.body.size", rw.written),
+			)
+			span.SetAttributes(c.headerAttributes("http.response.header", rw.Header(), c.responseHeaders)...)
+			if c.bodyCapture != nil && c.capturesRoute(route, r.URL.Path) {
+				span.SetAttributes(c.bodyAttributes("http.request.body", body.capture, r.Header)...)
+				span.SetAttributes(c.bodyAttributes("http.response.body", rw.capture, rw.Header())...)
+			}
+
+			measurement := metric.WithAttributes(attributes...)
+			instruments.duration.Record(ctx, time.Since(start).Seconds(), measurement)
+			instruments.requestSize.Record(ctx, requestSize, measurement)
+			instruments.responseSize.Record(ctx, rw.written, measurement)
+		})
+	}
+}
+
+// debugRequested checks the debug header against the shared secret in
+// constant time.
+func (c config) debugRequested(r *http.Request) bool {
+	if c.debugHeader == "" || c.debugSecret == "" {
+		return false
+	}
+	value := r.Header.Get(c.debugHeader)
+	return subtle.ConstantTimeCompare([]byte(value), []byte(c.debugSecret)) == 1
+}
+
+// setTraceResponseHeaders sets the W3C traceresponse header and a
+// Server-Timing entry, which browsers expose to scripts, for recorded
+// requests.
+func setTraceResponseHeaders(ctx context.Context, h http.Header) {
+	traceID, spanID := tracker.TraceID(ctx), tracker.SpanID(ctx)
+	if traceID == "" || spanID == "" {
+		return
+	}
+	flags := trace.SpanContextFromContext(ctx).TraceFlags()
+	value := "00-" + traceID + "-" + spanID + "-" + flags.String()
+	h.Set("traceresponse", value)
+	h.Add("Server-Timing", `traceparent;desc="`+value+`"`)
+	h.Add("Access-Control-Expose-Headers", "traceresponse")
+}
+
+func (c config) serverRequestAttributes(r *http.Request) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.path", r.URL.Path),
+		attribute.String("url.scheme", scheme(r)),
+		attribute.String("network.protocol.version", protocolVersion(r.ProtoMajor, r.ProtoMinor)),
+	}
+	if r.URL.RawQuery != "" {
+		attributes = append(attributes, attribute.String("url.query", redactQuery(r.URL.RawQuery, c.redactedFields)))
+	}
+	if host, port, err := net.SplitHostPort(r.Host); err == nil {
+		attributes = append(attributes, attribute.String("server.address", host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attributes = append(attributes, attribute.Int("server.port", p))
+		}
+	} else if r.Host != "" {
+		attributes = append(attributes, attribute.String("server.address", r.Host))
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		attributes = append(attributes, attribute.String("client.address", host))
+	}
+	if ua := r.UserAgent(); ua != "" {
+		attributes = append(attributes, attribute.String("user_agent.original", ua))
+	}
+	return attributes
+}
+
+// protocolVersion formats an HTTP version as the semantic conventions do:
+// "1.1", or "2" for versions without a minor number.
+func protocolVersion(major, minor int) string {
+	if minor == 0 && major > 1 {
+		return strconv.Itoa(major)
+	}
+	return strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
+
+// serverInstruments are the HTTP server metrics of the semantic conventions.
+type serverInstruments struct {
+	duration     metric.Float64Histogram
+	active       metric.Int64UpDownCounter
+	requestSize  metric.Int64Histogram
+	responseSize metric.Int64Histogram
+}
+
+var serverInstrumentsCache sync.Map // metric.MeterProvider -> *serverInstruments
+
+// durationBuckets are the bucket boundaries advised by the semantic
+// conventions for HTTP durations, in seconds.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// serverInstrumentsFor returns the instruments of mp. They are created again
+// once the tracker's meter provider replaces the global one.
+func serverInstrumentsFor(mp metric.MeterProvider) *serverInstruments {
+	if i, ok := serverInstrumentsCache.Load(mp); ok {
+		return i.(*serverInstruments)
+	}
+	meter := mp.Meter(instrumentationName)
+	var i serverInstruments
+	i.duration, _ = meter.Float64Histogram("http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of HTTP server requests."),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	i.active, _ = meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Number of active HTTP server requests."))
+	i.requestSize, _ = meter.Int64Histogram("http.server.request.body.size",
+		metric.WithUnit("By"),
+		metric.WithDescription("Size of HTTP server request bodies."))
+	i.responseSize, _ = meter.Int64Histogram("http.server.response.body.size",
+		metric.WithUnit("By"),
+		metric.WithDescription("Size of HTTP server response bodies."))
+	actual, _ := serverInstrumentsCache.LoadOrStore(mp, &i)
+	return actual.(*serverInstruments)
+}
+
+// countingReader counts the bytes read from a request body whose length is
+// not known in advance, and keeps its start when bodies are captured.
+type countingReader struct {
+	io.ReadCloser
+	n       atomic.Int64
+	capture *bodyBuffer
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	r.capture.write(p[:n])
+	return n, err
+}
+
+// responseWriter records the status code and the number of bytes written,
+// and keeps the start of the body when bodies are captured.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+	capture     *bodyBuffer
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		// Informational responses may precede the final one.
+		if status >= 200 || status == http.StatusSwitchingProtocols {
+			w.wroteHeader = true
+			w.status = status
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	w.capture.write(b[:n])
+	return n, err
+}
+
+// Flush keeps streaming handlers working, which check for http.Flusher.
+func (w *responseWriter) Flush() {
+	w.wroteHeader = true
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack keeps protocol upgrades such as WebSockets working, which check for
+// http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// hijack the connection.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,392 @@
+package mwhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestMiddleware wraps next with Middleware, recording spans into the
+// returned exporter.
+func newTestMiddleware(next http.Handler, opts ...Option) (http.Handler, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	cfg := &tracker.Config{Tp: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}
+	return Middleware(cfg, opts...)(next), exporter
+}
+
+func TestMiddlewareRedactsQuery(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	cfg := &tracker.Config{Tp: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}
+	handler := Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/reset?token=abc&lang=en", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if got, want := spanAttribute(spans[0], "url.query"), "token=[REDACTED]&lang=en"; got != want {
+		t.Errorf("url.query = %q, want %q", got, want)
+	}
+}
+
+func TestMiddlewareBodyCapture(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	cfg := &tracker.Config{Tp: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}
+	handler := Middleware(cfg,
+		WithBodyCapture(BodyCapture{ContentTypes: []string{"application/*", "text/plain"}}),
+		WithRedactedFields("password"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+	}))
+
+	for _, contentType := range []string{"application/x-www-form-urlencoded", "text/plain"} {
+		r := httptest.NewRequest("POST", "/login", strings.NewReader("user=ann&password=hunter2"))
+		r.Header.Set("Content-Type", contentType)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if got, want := spanAttribute(spans[0], "http.request.body.content"), "user=ann&password=[REDACTED]"; got != want {
+		t.Errorf("form body = %q, want %q", got, want)
+	}
+	if got := spanAttribute(spans[1], "http.request.body.content"); got != "" {
+		t.Errorf("text body recorded as %q", got)
+	}
+}
+
+func TestMiddlewareSkipsEncodedBodies(t *testing.T) {
+	handler, exporter := newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", r.Header.Get("Content-Encoding"))
+		io.WriteString(w, `{"ok":true}`)
+	}), WithBodyCapture(BodyCapture{}))
+
+	tests := []struct {
+		encoding string
+		captured bool
+	}{
+		{"", true},
+		{"identity", true},
+		{"gzip", false},
+		{"identity, br", false},
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"id":1}`))
+		r.Header.Set("Content-Type", "application/json")
+		if tt.encoding != "" {
+			r.Header.Set("Content-Encoding", tt.encoding)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		span := exporter.GetSpans()[0]
+		for _, key := range []string{"http.request.body.content", "http.response.body.content"} {
+			if got := spanAttribute(span, key) != ""; got != tt.captured {
+				t.Errorf("Content-Encoding %q: %s recorded = %v, want %v", tt.encoding, key, got, tt.captured)
+			}
+		}
+	}
+}
+
+func spanAttribute(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestMiddlewareRouteName(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("example.com/static/", func(w http.ResponseWriter, r *http.Request) {})
+	handler, exporter := newTestMiddleware(mux)
+
+	tests := []struct {
+		target, name, route string
+	}{
+		{"/users/42", "GET /users/{id}", "/users/{id}"},
+		{"http://example.com/static/app.js", "GET /static/", "/static/"},
+		{"/missing", "GET", ""},
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.target, nil))
+		span := exporter.GetSpans()[0]
+		if span.Name != tt.name {
+			t.Errorf("%s: span name = %q, want %q", tt.target, span.Name, tt.name)
+		}
+		if got := spanAttribute(span, "http.route"); got != tt.route {
+			t.Errorf("%s: http.route = %q, want %q", tt.target, got, tt.route)
+		}
+	}
+}
+
+// muxPattern is how the route is found before Go 1.23, when the request does
+// not carry the pattern.
+func TestMuxPattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	if got := muxPattern(mux, httptest.NewRequest("GET", "/users/42", nil)); got != "GET /users/{id}" {
+		t.Errorf("muxPattern() = %q, want the matching route", got)
+	}
+	if got := muxPattern(mux, httptest.NewRequest("GET", "/missing", nil)); got != "" {
+		t.Errorf("muxPattern() = %q for an unmatched request", got)
+	}
+	if got := muxPattern(http.NotFoundHandler(), httptest.NewRequest("GET", "/users/42", nil)); got != "" {
+		t.Errorf("muxPattern() = %q for a handler that is not a ServeMux", got)
+	}
+}
+
+func TestMiddlewareStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		code      codes.Code
+		errorType string
+	}{
+		{http.StatusOK, codes.Unset, ""},
+		{http.StatusNotFound, codes.Unset, ""},
+		{http.StatusTooManyRequests, codes.Unset, ""},
+		{http.StatusInternalServerError, codes.Error, "500"},
+		{http.StatusServiceUnavailable, codes.Error, "503"},
+	}
+	for _, tt := range tests {
+		handler, exporter := newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		span := exporter.GetSpans()[0]
+		if span.Status.Code != tt.code {
+			t.Errorf("%d: status = %v, want %v", tt.status, span.Status.Code, tt.code)
+		}
+		if got := spanAttribute(span, "error.type"); got != tt.errorType {
+			t.Errorf("%d: error.type = %q, want %q", tt.status, got, tt.errorType)
+		}
+		if got := spanAttribute(span, "http.response.status_code"); got != strconv.Itoa(tt.status) {
+			t.Errorf("%d: http.response.status_code = %s", tt.status, got)
+		}
+	}
+}
+
+// withTestMeterProvider installs a global meter provider reading into the
+// returned reader until the end of the test.
+func withTestMeterProvider(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+	return reader
+}
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func TestMiddlewareMetrics(t *testing.T) {
+	reader := withTestMeterProvider(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /orders", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	})
+	handler, _ := newTestMiddleware(mux)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", strings.NewReader("order")))
+	metrics := collectMetrics(t, reader)
+
+	want := attribute.NewSet(
+		attribute.String("http.route", "/orders"),
+		attribute.String("http.request.method", "POST"),
+		attribute.String("url.scheme", "http"),
+		attribute.Int("http.response.status_code", http.StatusCreated),
+		attribute.String("network.protocol.version", "1.1"),
+	)
+	duration, ok := metrics["http.server.request.duration"].(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 1 {
+		t.Fatalf("http.server.request.duration = %v, want one request", metrics["http.server.request.duration"])
+	}
+	if got := duration.DataPoints[0].Attributes; !got.Equals(&want) {
+		t.Errorf("duration attributes = %v, want %v", got.ToSlice(), want.ToSlice())
+	}
+	for name, size := range map[string]int64{"http.server.request.body.size": 5, "http.server.response.body.size": 7} {
+		h, ok := metrics[name].(metricdata.Histogram[int64])
+		if !ok || len(h.DataPoints) != 1 || h.DataPoints[0].Sum != size {
+			t.Errorf("%s = %v, want %d bytes", name, metrics[name], size)
+		}
+	}
+	active, ok := metrics["http.server.active_requests"].(metricdata.Sum[int64])
+	if !ok || len(active.DataPoints) != 1 || active.DataPoints[0].Value != 0 {
+		t.Errorf("http.server.active_requests = %v, want 0 after the request", metrics["http.server.active_requests"])
+	}
+}
+
+func TestResponseWriterFlushAndUnwrap(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler, exporter := newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != recorder {
+			t.Error("Unwrap does not return the underlying writer")
+		}
+		io.WriteString(w, "chunk")
+		w.(http.Flusher).Flush()
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("ResponseController.Flush() = %v", err)
+		}
+	}))
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/stream", nil))
+	if !recorder.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+	if got := spanAttribute(exporter.GetSpans()[0], "http.response.body.size"); got != "5" {
+		t.Errorf("http.response.body.size = %s, want 5", got)
+	}
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	handler, _ := newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() = %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hijacked" {
+		t.Errorf("body = %q, want the response written on the hijacked connection", body)
+	}
+}
+
+func TestMiddlewareDebugHeader(t *testing.T) {
+	var debug bool
+	handler, _ := newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		debug = tracker.DebugFromContext(r.Context())
+	}), WithDebugHeader("X-Debug-Token", "s3cret"))
+
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"s3cret", true},
+		{"s3cre", false},
+		{"s3cret ", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.token != "" {
+			r.Header.Set("X-Debug-Token", tt.token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if debug != tt.want {
+			t.Errorf("token %q: debug = %v, want %v", tt.token, debug, tt.want)
+		}
+	}
+
+	// Without a secret the header is ignored.
+	handler, _ = newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		debug = tracker.DebugFromContext(r.Context())
+	}), WithDebugHeader("X-Debug-Token", ""))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Debug-Token", "")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if debug {
+		t.Error("debug enabled without a secret")
+	}
+}
+
+func TestSetTraceResponseHeaders(t *testing.T) {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithIDGenerator(fixedIDs{}))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	h := http.Header{}
+	h.Set("Access-Control-Expose-Headers", "X-Request-Id")
+	setTraceResponseHeaders(ctx, h)
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := h.Get("traceresponse"); got != want {
+		t.Errorf("traceresponse = %q, want %q", got, want)
+	}
+	if got := h.Values("Server-Timing"); len(got) != 1 || got[0] != `traceparent;desc="`+want+`"` {
+		t.Errorf("Server-Timing = %q", got)
+	}
+	if got := h.Values("Access-Control-Expose-Headers"); strings.Join(got, ",") != "X-Request-Id,traceresponse" {
+		t.Errorf("Access-Control-Expose-Headers = %q, want traceresponse added", got)
+	}
+
+	// Requests that are not recorded get no headers.
+	h = http.Header{}
+	setTraceResponseHeaders(context.Background(), h)
+	if len(h) != 0 {
+		t.Errorf("headers set without a span: %v", h)
+	}
+}
+
+func TestMiddlewareTraceResponseHeader(t *testing.T) {
+	handler, exporter := newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), WithTraceResponseHeader())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	sc := exporter.GetSpans()[0].SpanContext
+	if got, want := recorder.Header().Get("traceresponse"), "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01"; got != want {
+		t.Errorf("traceresponse = %q, want %q", got, want)
+	}
+
+	handler, _ = newTestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if got := recorder.Header().Get("traceresponse"); got != "" {
+		t.Errorf("traceresponse = %q without WithTraceResponseHeader", got)
+	}
+}
+
+// fixedIDs generates the IDs of the W3C trace context examples.
+type fixedIDs struct{}
+
+func (fixedIDs) NewIDs(context.Context) (trace.TraceID, trace.SpanID) {
+	return trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+}
+
+func (fixedIDs) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	return trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+}
@@ -0,0 +1,305 @@
+package mwhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport is an http.RoundTripper that creates a client span for each
+// request and propagates its context to the server.
+type Transport struct {
+	base http.RoundTripper
+	c    config
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewTransport wraps base, or http.DefaultTransport when base is nil:
+//
+//	client := &http.Client{Transport: mwhttp.NewTransport(nil, mwhttp.WithPhaseSpans())}
+//
+// Client spans are named after the request method and end once the response
+// body is read or closed. Responses with a status of 400 or more and
+// transport errors mark them as failed. The request duration is recorded per
+// host in the http.client.request.duration histogram.
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base, c: newConfig(nil, opts)}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !t.c.instrumented(r) {
+		return t.base.RoundTrip(r)
+	}
+	start := time.Now()
+	instruments := clientInstrumentsFor(tracker.ActiveMeterProvider())
+
+	ctx, span := t.c.tracer().Start(r.Context(), r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.clientRequestAttributes(r)...),
+		trace.WithAttributes(t.c.headerAttributes("http.request.header", r.Header, t.c.requestHeaders)...),
+	)
+	var phases *phaseTracer
+	if t.c.phases != phasesNone {
+		phases = &phaseTracer{ctx: ctx, span: span, spans: t.c.phases == phasesSpans}
+		ctx = httptrace.WithClientTrace(ctx, phases.clientTrace())
+	}
+
+	// A RoundTripper must not modify the request, so inject into a copy.
+	r = r.Clone(ctx)
+	t.c.textMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	captureBodies := t.c.bodyCapture != nil && t.c.capturesRoute("", r.URL.Path)
+	var requestBody *countingReader
+	if captureBodies && r.Body != nil && r.Body != http.NoBody {
+		requestBody = &countingReader{ReadCloser: r.Body, capture: t.c.newBodyBuffer()}
+		r.Body = requestBody
+	}
+
+	resp, err := t.base.RoundTrip(r)
+
+	attributes := []attribute.KeyValue{
+		attribute.String("http.request.method", r.Method),
+		attribute.String("server.address", r.URL.Hostname()),
+	}
+	if port := serverPort(r.URL.Port(), r.URL.Scheme); port > 0 {
+		attributes = append(attributes, attribute.Int("server.port", port))
+	}
+	var responseBody *bodyBuffer
+	end := func() {
+		if requestBody != nil {
+			span.SetAttributes(t.c.bodyAttributes("http.request.body", requestBody.capture, r.Header)...)
+		}
+		if responseBody != nil {
+			span.SetAttributes(t.c.bodyAttributes("http.response.body", responseBody, resp.Header)...)
+		}
+		phases.finish()
+		span.End()
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		attributes = append(attributes, attribute.String("error.type", fmt.Sprintf("%T", err)))
+		instruments.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+		end()
+		return resp, err
+	}
+
+	attributes = append(attributes, attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		attributes = append(attributes, attribute.String("error.type", strconv.Itoa(resp.StatusCode)))
+	}
+	span.SetAttributes(attributes...)
+	// The version is the one the server answered with, which the
+	// transport may have negotiated up from the request's.
+	span.SetAttributes(attribute.String("network.protocol.version", protocolVersion(resp.ProtoMajor, resp.ProtoMinor)))
+	span.SetAttributes(t.c.headerAttributes("http.response.header", resp.Header, t.c.responseHeaders)...)
+	instruments.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+
+	// The body of a protocol switch is the connection itself and must keep
+	// implementing io.Writer, so it is not wrapped.
+	if resp.Body == nil || resp.Body == http.NoBody || resp.StatusCode == http.StatusSwitchingProtocols {
+		end()
+	} else {
+		if captureBodies {
+			responseBody = t.c.newBodyBuffer()
+		}
+		resp.Body = &endingBody{ReadCloser: resp.Body, end: end, capture: responseBody}
+	}
+	return resp, nil
+}
+
+func (t *Transport) clientRequestAttributes(r *http.Request) []attribute.KeyValue {
+	// Credentials in the URL must not be recorded.
+	u := *r.URL
+	u.User = nil
+	u.RawQuery = redactQuery(u.RawQuery, t.c.redactedFields)
+	attributes := []attribute.KeyValue{
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.full", u.String()),
+		attribute.String("server.address", r.URL.Hostname()),
+	}
+	if port := serverPort(r.URL.Port(), r.URL.Scheme); port > 0 {
+		attributes = append(attributes, attribute.Int("server.port", port))
+	}
+	if service, ok := t.c.peerServices[r.URL.Host]; ok {
+		attributes = append(attributes, attribute.String("peer.service", service))
+	} else if service, ok := t.c.peerServices[r.URL.Hostname()]; ok {
+		attributes = append(attributes, attribute.String("peer.service", service))
+	}
+	return attributes
+}
+
+func serverPort(port, scheme string) int {
+	if p, err := strconv.Atoi(port); err == nil {
+		return p
+	}
+	switch scheme {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
+
+// endingBody ends the client span when the response body is read to the end
+// or closed, whichever comes first, keeping the start of the body when
+// bodies are captured.
+type endingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	end     func()
+	capture *bodyBuffer
+}
+
+func (b *endingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture.write(p[:n])
+	if err == io.EOF {
+		b.once.Do(b.end)
+	}
+	return n, err
+}
+
+func (b *endingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.end)
+	return err
+}
+
+// clientInstruments are the HTTP client metrics of the semantic conventions.
+type clientInstruments struct {
+	duration metric.Float64Histogram
+}
+
+var clientInstrumentsCache sync.Map // metric.MeterProvider -> *clientInstruments
+
+func clientInstrumentsFor(mp metric.MeterProvider) *clientInstruments {
+	if i, ok := clientInstrumentsCache.Load(mp); ok {
+		return i.(*clientInstruments)
+	}
+	meter := mp.Meter(instrumentationName)
+	var i clientInstruments
+	i.duration, _ = meter.Float64Histogram("http.client.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of HTTP client requests."),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	actual, _ := clientInstrumentsCache.LoadOrStore(mp, &i)
+	return actual.(*clientInstruments)
+}
+
+// phaseTracer records the phases of a request reported by httptrace, either
+// as events on the client span or as child spans of it.
+type phaseTracer struct {
+	ctx   context.Context
+	span  trace.Span
+	spans bool
+
+	mu     sync.Mutex
+	active map[string]trace.Span
+}
+
+func (p *phaseTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.span.SetAttributes(attribute.Bool("http.connection.reused", info.Reused))
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			p.start("dns", "", attribute.String("server.address", info.Host))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			p.end("dns", "", info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			// Several addresses may be dialled in parallel.
+			p.start("connect", addr, attribute.String("network.peer.address", addr))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			p.end("connect", addr, err)
+		},
+		TLSHandshakeStart: func() {
+			p.start("tls", "")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.end("tls", "", err)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				p.start("ttfb", "")
+			}
+		},
+		GotFirstResponseByte: func() {
+			p.end("ttfb", "", nil)
+		},
+	}
+}
+
+func (p *phaseTracer) start(phase, key string, attrs ...attribute.KeyValue) {
+	name := "http." + phase
+	if !p.spans {
+		p.span.AddEvent(name+".start", trace.WithAttributes(attrs...))
+		return
+	}
+	_, span := p.span.TracerProvider().Tracer(instrumentationName).Start(p.ctx, name, trace.WithAttributes(attrs...))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active == nil {
+		p.active = make(map[string]trace.Span)
+	}
+	p.active[phase+" "+key] = span
+}
+
+func (p *phaseTracer) end(phase, key string, err error) {
+	name := "http." + phase
+	if !p.spans {
+		var attrs []attribute.KeyValue
+		if err != nil {
+			attrs = append(attrs, attribute.String("error.message", err.Error()))
+		}
+		p.span.AddEvent(name+".done", trace.WithAttributes(attrs...))
+		return
+	}
+	p.mu.Lock()
+	span, ok := p.active[phase+" "+key]
+	delete(p.active, phase+" "+key)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// finish ends the phases that never completed, e.g. when the request was
+// cancelled.
+func (p *phaseTracer) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, span := range p.active {
+		span.End()
+		delete(p.active, key)
+	}
+}
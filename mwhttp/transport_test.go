@@ -0,0 +1,273 @@
+package mwhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withTestTracerProvider installs a global tracer provider recording into
+// the returned exporter.
+func withTestTracerProvider(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestTransportRedactsURL(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(nil)}
+	u := strings.Replace(server.URL, "http://", "http://user:secret@", 1) + "/search?api_key=abc&q=shoes"
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	want := server.URL + "/search?api_key=[REDACTED]&q=shoes"
+	if got := spanAttribute(spans[0], "url.full"); got != want {
+		t.Errorf("url.full = %q, want %q", got, want)
+	}
+}
+
+// roundTripperFunc lets a function stand in for the base transport.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func newTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransportEndsSpanWithBody(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "payload")
+	})
+	client := &http.Client{Transport: NewTransport(nil)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exporter.GetSpans()); n != 0 {
+		t.Fatalf("got %d spans before the body was read, want 0", n)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exporter.GetSpans()); n != 1 {
+		t.Errorf("got %d spans once the body was read to EOF, want 1", n)
+	}
+	resp.Body.Close()
+	if n := len(exporter.GetSpans()); n != 1 {
+		t.Errorf("got %d spans after Close, want the span ended once", n)
+	}
+
+	exporter.Reset()
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := len(exporter.GetSpans()); n != 1 {
+		t.Errorf("got %d spans after Close without reading, want 1", n)
+	}
+}
+
+func TestTransportStatus(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	tests := []struct {
+		status    int
+		code      codes.Code
+		errorType string
+	}{
+		{http.StatusOK, codes.Unset, ""},
+		{http.StatusFound, codes.Unset, ""},
+		{http.StatusBadRequest, codes.Error, "400"},
+		{http.StatusNotFound, codes.Error, "404"},
+		{http.StatusBadGateway, codes.Error, "502"},
+	}
+	client := &http.Client{
+		Transport:     NewTransport(nil),
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		})
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		span := exporter.GetSpans()[0]
+		if span.Status.Code != tt.code {
+			t.Errorf("%d: status = %v, want %v", tt.status, span.Status.Code, tt.code)
+		}
+		if got := spanAttribute(span, "error.type"); got != tt.errorType {
+			t.Errorf("%d: error.type = %q, want %q", tt.status, got, tt.errorType)
+		}
+	}
+}
+
+func TestTransportInjectsTraceparent(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	var received string
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	})
+	r, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	sc := exporter.GetSpans()[0].SpanContext
+	if want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"; received != want {
+		t.Errorf("traceparent = %q, want %q", received, want)
+	}
+	if r.Header.Get("traceparent") != "" {
+		t.Error("the caller's request was modified")
+	}
+}
+
+func TestTransportPeerService(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		services map[string]string
+		want     string
+	}{
+		{"host and port", map[string]string{u.Host: "inventory", u.Hostname(): "other"}, "inventory"},
+		{"hostname", map[string]string{u.Hostname(): "inventory"}, "inventory"},
+		{"unknown", map[string]string{"example.com": "inventory"}, ""},
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		resp, err := (&http.Client{Transport: NewTransport(nil, WithPeerServices(tt.services))}).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := spanAttribute(exporter.GetSpans()[0], "peer.service"); got != tt.want {
+			t.Errorf("%s: peer.service = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransportPhases(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	get := func(opts ...Option) tracetest.SpanStubs {
+		t.Helper()
+		exporter.Reset()
+		// A new transport dials a new connection.
+		transport := NewTransport(&http.Transport{}, opts...)
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return exporter.GetSpans()
+	}
+
+	spans := get(WithPhaseEvents())
+	if len(spans) != 1 {
+		t.Fatalf("phase events: got %d spans, want only the client span", len(spans))
+	}
+	var events []string
+	for _, event := range spans[0].Events {
+		events = append(events, event.Name)
+	}
+	want := []string{"http.connect.start", "http.connect.done", "http.ttfb.start", "http.ttfb.done"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("phase events = %q, want %q", events, want)
+	}
+	if got := spanAttribute(spans[0], "http.connection.reused"); got != "false" {
+		t.Errorf("http.connection.reused = %q, want false", got)
+	}
+
+	spans = get(WithPhaseSpans())
+	client := spans[len(spans)-1]
+	if client.SpanKind != trace.SpanKindClient {
+		t.Fatalf("last span is %q, want the client span", client.Name)
+	}
+	var phases []string
+	for _, span := range spans[:len(spans)-1] {
+		phases = append(phases, span.Name)
+		if span.Parent.SpanID() != client.SpanContext.SpanID() {
+			t.Errorf("phase span %q is not a child of the client span", span.Name)
+		}
+	}
+	if want := []string{"http.connect", "http.ttfb"}; strings.Join(phases, ",") != strings.Join(want, ",") {
+		t.Errorf("phase spans = %q, want %q", phases, want)
+	}
+	if len(client.Events) != 0 {
+		t.Errorf("client span has events %v with phase spans", client.Events)
+	}
+
+	if spans = get(); len(spans) != 1 || len(spans[0].Events) != 0 {
+		t.Error("phases were recorded without an option")
+	}
+}
+
+func TestTransportProtocolVersion(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	// The request is HTTP/1.1 but the server answered over HTTP/2.
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Proto:      "HTTP/2.0",
+			ProtoMajor: 2,
+			Body:       http.NoBody,
+			Request:    r,
+		}, nil
+	})
+	r := httptest.NewRequest("GET", "https://example.com/", nil)
+	if _, err := NewTransport(base).RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+	if got := spanAttribute(exporter.GetSpans()[0], "network.protocol.version"); got != "2" {
+		t.Errorf("network.protocol.version = %q, want the response's 2", got)
+	}
+}
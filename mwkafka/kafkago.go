@@ -0,0 +1,213 @@
+package mwkafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Writer is a kafka-go writer creating a producer span for each message and
+// injecting its context into the message headers. With Async set, the span
+// of a message ends when the writer calls Completion for it.
+type Writer struct {
+	*kafka.Writer
+	c     config
+	async bool
+	spans sync.Map // *kafka.Header, the headers of a message -> trace.Span
+}
+
+// NewWriter wraps w. For async writers, it sets w.Completion to a function
+// ending the spans of the messages and then calling the Completion set
+// before, so Async and Completion must not be changed afterwards.
+//
+//	w := mwkafka.NewWriter(&kafka.Writer{Addr: kafka.TCP("localhost:9092"), Topic: "orders"})
+func NewWriter(w *kafka.Writer, opts ...Option) *Writer {
+	wr := &Writer{Writer: w, c: newConfig(opts)}
+	if w.Async {
+		wr.async = true
+		completion := w.Completion
+		w.Completion = func(messages []kafka.Message, err error) {
+			for _, msg := range messages {
+				if span, ok := wr.spans.LoadAndDelete(headersKey(msg)); ok {
+					finishSpan(span.(trace.Span), err)
+				}
+			}
+			if completion != nil {
+				completion(messages, err)
+			}
+		}
+	}
+	return wr
+}
+
+// WriteMessages writes msgs like kafka.Writer.WriteMessages. The headers of
+// msgs are copied, not modified.
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	msgs = append([]kafka.Message(nil), msgs...)
+	spans := make([]trace.Span, len(msgs))
+	for i := range msgs {
+		msg := &msgs[i]
+		topic := msg.Topic
+		if topic == "" {
+			topic = w.Topic
+		}
+		// The copy has room for one header so that headersKey identifies the
+		// message.
+		msg.Headers = append(make([]kafka.Header, 0, len(msg.Headers)+1), msg.Headers...)
+		_, spans[i] = tracker.StartProducerSpan(ctx, system, topic, kafkaGoHeaders{&msg.Headers},
+			trace.WithAttributes(w.c.attributes...),
+			trace.WithAttributes(attribute.Int("messaging.message.body.size", len(msg.Value))))
+		w.c.recordSent(ctx, topic, len(msg.Value))
+		if w.async {
+			w.spans.Store(headersKey(*msg), spans[i])
+		}
+	}
+
+	err := w.Writer.WriteMessages(ctx, msgs...)
+	if w.async {
+		if err == nil {
+			return nil
+		}
+		// The messages were not queued.
+		for _, msg := range msgs {
+			w.spans.Delete(headersKey(msg))
+		}
+	}
+	var writeErrors kafka.WriteErrors
+	perMessage := errors.As(err, &writeErrors) && len(writeErrors) == len(msgs)
+	for i, span := range spans {
+		if perMessage {
+			finishSpan(span, writeErrors[i])
+		} else {
+			finishSpan(span, err)
+		}
+	}
+	return err
+}
+
+// headersKey identifies a message passed to Completion by the array holding
+// its headers, which WriteMessages allocates for each message.
+func headersKey(msg kafka.Message) *kafka.Header {
+	if cap(msg.Headers) == 0 {
+		return nil
+	}
+	return &msg.Headers[:1][0]
+}
+
+// Reader is a kafka-go reader recording the size and lag of the messages it
+// receives, with methods creating consumer spans for their processing.
+type Reader struct {
+	*kafka.Reader
+	c config
+}
+
+// NewReader wraps r.
+//
+//	r := mwkafka.NewReader(kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, GroupID: "billing", Topic: "orders"}))
+//	for {
+//		msg, err := r.FetchMessage(ctx)
+//		if err != nil {
+//			break
+//		}
+//		err = r.Process(ctx, msg, func(ctx context.Context) error {
+//			return handle(ctx, msg)
+//		})
+//		...
+//	}
+func NewReader(r *kafka.Reader, opts ...Option) *Reader {
+	opts = append([]Option{WithConsumerGroup(r.Config().GroupID)}, opts...)
+	return &Reader{Reader: r, c: newConfig(opts)}
+}
+
+// FetchMessage fetches a message like kafka.Reader.FetchMessage.
+func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	msg, err := r.Reader.FetchMessage(ctx)
+	if err == nil {
+		r.c.recordReceived(ctx, msg.Topic, int32(msg.Partition), msg.Offset, msg.HighWaterMark, len(msg.Value))
+	}
+	return msg, err
+}
+
+// ReadMessage reads a message like kafka.Reader.ReadMessage.
+func (r *Reader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	msg, err := r.Reader.ReadMessage(ctx)
+	if err == nil {
+		r.c.recordReceived(ctx, msg.Topic, int32(msg.Partition), msg.Offset, msg.HighWaterMark, len(msg.Value))
+	}
+	return msg, err
+}
+
+// Process calls fn with a consumer span for msg, a child of the producer
+// span, and records the processing duration.
+func (r *Reader) Process(ctx context.Context, msg kafka.Message, fn func(context.Context) error) error {
+	start := time.Now()
+	headers := msg.Headers
+	ctx, span := tracker.StartConsumerSpan(ctx, system, msg.Topic, kafkaGoHeaders{&headers},
+		trace.WithAttributes(r.c.messageAttributes(int32(msg.Partition), msg.Offset, len(msg.Value))...))
+	err := fn(ctx)
+	r.c.finishProcess(ctx, span, msg.Topic, start, err)
+	return err
+}
+
+// ProcessBatch calls fn with one consumer span for msgs, linked to the
+// producer span of each message, and records the processing duration. The
+// batch is attributed to the topic of its messages, or to no topic when they
+// come from several.
+func (r *Reader) ProcessBatch(ctx context.Context, msgs []kafka.Message, fn func(context.Context) error) error {
+	if len(msgs) == 0 {
+		return fn(ctx)
+	}
+	start := time.Now()
+	carriers := make([]kafkaGoHeaders, len(msgs))
+	topic := msgs[0].Topic
+	for i := range msgs {
+		headers := msgs[i].Headers
+		carriers[i] = kafkaGoHeaders{&headers}
+		if msgs[i].Topic != topic {
+			topic = ""
+		}
+	}
+	ctx, span := tracker.StartBatchConsumerSpan(ctx, system, topic, carriers,
+		trace.WithAttributes(r.c.batchAttributes()...))
+	err := fn(ctx)
+	r.c.finishProcess(ctx, span, topic, start, err)
+	return err
+}
+
+// kafkaGoHeaders adapts kafka-go message headers for propagation.
+type kafkaGoHeaders struct {
+	headers *[]kafka.Header
+}
+
+func (h kafkaGoHeaders) Get(key string) string {
+	for _, header := range *h.headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h kafkaGoHeaders) Set(key, value string) {
+	for i, header := range *h.headers {
+		if header.Key == key {
+			(*h.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*h.headers = append(*h.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (h kafkaGoHeaders) Keys() []string {
+	keys := make([]string, len(*h.headers))
+	for i, header := range *h.headers {
+		keys[i] = header.Key
+	}
+	return keys
+}
@@ -0,0 +1,124 @@
+package mwkafka
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// fakeBroker answers the metadata and produce requests of a kafka-go writer
+// for one topic with one partition.
+type fakeBroker struct {
+	err error
+}
+
+func (b fakeBroker) RoundTrip(ctx context.Context, addr net.Addr, req kafka.Request) (kafka.Response, error) {
+	switch req := req.(type) {
+	case *metadata.Request:
+		topics := make([]metadata.ResponseTopic, len(req.TopicNames))
+		for i, name := range req.TopicNames {
+			topics[i] = metadata.ResponseTopic{Name: name, Partitions: []metadata.ResponsePartition{{}}}
+		}
+		return &metadata.Response{
+			Brokers: []metadata.ResponseBroker{{Host: "localhost", Port: 9092}},
+			Topics:  topics,
+		}, nil
+	case *produce.Request:
+		if b.err != nil {
+			return nil, b.err
+		}
+		topics := make([]produce.ResponseTopic, len(req.Topics))
+		for i, topic := range req.Topics {
+			topics[i] = produce.ResponseTopic{Topic: topic.Topic, Partitions: []produce.ResponsePartition{{BaseOffset: 7}}}
+		}
+		return &produce.Response{Topics: topics}, nil
+	}
+	return nil, errors.New("unexpected request")
+}
+
+func TestWriter(t *testing.T) {
+	exporter := withTestProviders(t)
+	w := NewWriter(&kafka.Writer{Addr: kafka.TCP("localhost:9092"), Topic: "orders", Transport: fakeBroker{}, BatchTimeout: time.Millisecond})
+	defer w.Close()
+
+	headers := []kafka.Header{{Key: "source", Value: []byte("test")}}
+	if err := w.WriteMessages(context.Background(), kafka.Message{Value: []byte("order"), Headers: headers}); err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 {
+		t.Errorf("headers of the message were modified: %v", headers)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if spans[0].Name != "publish orders" {
+		t.Errorf("span name = %q, want %q", spans[0].Name, "publish orders")
+	}
+}
+
+func TestAsyncWriterEndsSpansOnCompletion(t *testing.T) {
+	exporter := withTestProviders(t)
+	completed := make(chan error, 1)
+	broker := fakeBroker{err: errors.New("broker down")}
+	w := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("localhost:9092"),
+		Topic:        "orders",
+		Transport:    broker,
+		Async:        true,
+		MaxAttempts:  1,
+		BatchTimeout: time.Millisecond,
+		Completion: func(messages []kafka.Message, err error) {
+			completed <- err
+		},
+	})
+	defer w.Close()
+
+	if err := w.WriteMessages(context.Background(), kafka.Message{Value: []byte("order")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-completed:
+		if err == nil {
+			t.Fatal("Completion called without the error of the broker")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Completion not called")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error {
+		t.Errorf("span status = %v, want an error", spans[0].Status)
+	}
+}
+
+func TestProcessBatchSeveralTopics(t *testing.T) {
+	exporter := withTestProviders(t)
+	r := &Reader{c: newConfig(nil)}
+	msgs := []kafka.Message{{Topic: "orders"}, {Topic: "refunds"}}
+	if err := r.ProcessBatch(context.Background(), msgs, func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if spans[0].Name != "process" {
+		t.Errorf("span name = %q, want process", spans[0].Name)
+	}
+	for _, kv := range spans[0].Attributes {
+		if kv.Key == "messaging.destination.name" {
+			t.Errorf("messaging.destination.name = %q, want none", kv.Value.AsString())
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package mwkafka instruments Kafka producers and consumers of
+// segmentio/kafka-go and IBM/sarama with the providers and propagators
+// configured by tracker.Track.
+package mwkafka
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/middleware-labs/golang-apm/mwkafka"
+
+// system is the messaging.system of every span and metric.
+const system = "kafka"
+
+type config struct {
+	group      string
+	attributes []attribute.KeyValue
+}
+
+type Option interface {
+	apply(config) config
+}
+
+type optFunc func(config) config
+
+func (f optFunc) apply(c config) config { return f(c) }
+
+// WithConsumerGroup sets messaging.consumer.group.name on consumer spans
+// and metrics. NewReader takes it from the reader's GroupID.
+func WithConsumerGroup(group string) Option {
+	return optFunc(func(c config) config {
+		c.group = group
+		return c
+	})
+}
+
+// WithAttributes adds attributes to every span.
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return optFunc(func(c config) config {
+		c.attributes = append(c.attributes, attributes...)
+		return c
+	})
+}
+
+func newConfig(options []Option) config {
+	var c config
+	for _, opt := range options {
+		c = opt.apply(c)
+	}
+	return c
+}
+
+// messageAttributes returns the attributes of a consumer span for one
+// message.
+func (c config) messageAttributes(partition int32, offset int64, size int) []attribute.KeyValue {
+	attributes := append([]attribute.KeyValue{
+		attribute.String("messaging.destination.partition.id", strconv.Itoa(int(partition))),
+		attribute.Int64("messaging.kafka.message.offset", offset),
+		attribute.Int("messaging.message.body.size", size),
+	}, c.attributes...)
+	if c.group != "" {
+		attributes = append(attributes, attribute.String("messaging.consumer.group.name", c.group))
+	}
+	return attributes
+}
+
+// batchAttributes returns the attributes of a span for a batch of messages.
+func (c config) batchAttributes() []attribute.KeyValue {
+	if c.group == "" {
+		return c.attributes
+	}
+	return append([]attribute.KeyValue{attribute.String("messaging.consumer.group.name", c.group)}, c.attributes...)
+}
+
+// recordSent records the size of a published message.
+func (c config) recordSent(ctx context.Context, topic string, size int) {
+	instrumentsFor().size.Record(ctx, int64(size), metric.WithAttributes(
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.operation.type", "publish"),
+	))
+}
+
+// recordReceived records the size of a received message and the lag of its
+// partition. highWaterMark is the offset of the next message written to the
+// partition, or a negative number when it is unknown.
+func (c config) recordReceived(ctx context.Context, topic string, partition int32, offset, highWaterMark int64, size int) {
+	attributes := []attribute.KeyValue{
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", topic),
+	}
+	if c.group != "" {
+		attributes = append(attributes, attribute.String("messaging.consumer.group.name", c.group))
+	}
+	i := instrumentsFor()
+	i.size.Record(ctx, int64(size), metric.WithAttributes(append(attributes,
+		attribute.String("messaging.operation.type", "receive"))...))
+	if highWaterMark >= 0 {
+		i.lag.Record(ctx, max(highWaterMark-offset-1, 0), metric.WithAttributes(append(attributes,
+			attribute.String("messaging.destination.partition.id", strconv.Itoa(int(partition))))...))
+	}
+}
+
+// finishProcess sets the status of a consumer span from err, ends it and
+// records the processing duration. topic is empty for a batch of messages
+// from several topics.
+func (c config) finishProcess(ctx context.Context, span trace.Span, topic string, start time.Time, err error) {
+	attributes := []attribute.KeyValue{
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.operation.type", "process"),
+	}
+	if topic != "" {
+		attributes = append(attributes, attribute.String("messaging.destination.name", topic))
+	}
+	if c.group != "" {
+		attributes = append(attributes, attribute.String("messaging.consumer.group.name", c.group))
+	}
+	finishSpan(span, err)
+	instrumentsFor().duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+}
+
+func finishSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// instruments are the messaging metrics of one meter provider.
+type instruments struct {
+	size     metric.Int64Histogram
+	duration metric.Float64Histogram
+	lag      metric.Int64Gauge
+}
+
+var instrumentsCache sync.Map // metric.MeterProvider -> *instruments
+
+// instrumentsFor returns the instruments of the tracker's meter provider.
+// They are created again once the tracker's meter provider replaces the
+// global one.
+func instrumentsFor() *instruments {
+	mp := tracker.ActiveMeterProvider()
+	if i, ok := instrumentsCache.Load(mp); ok {
+		return i.(*instruments)
+	}
+	meter := mp.Meter(instrumentationName)
+	var i instruments
+	i.size, _ = meter.Int64Histogram("messaging.kafka.message.size",
+		metric.WithUnit("By"),
+		metric.WithDescription("Size of message values published and received."))
+	i.duration, _ = meter.Float64Histogram("messaging.process.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of processing a message or a batch of messages."))
+	i.lag, _ = meter.Int64Gauge("messaging.kafka.consumer.lag",
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of messages of a partition not yet received by the consumer."))
+	actual, _ := instrumentsCache.LoadOrStore(mp, &i)
+	return actual.(*instruments)
+}
@@ -0,0 +1,379 @@
+package mwkafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SyncProducer is a sarama producer creating a producer span for each
+// message and injecting its context into the message headers.
+type SyncProducer struct {
+	sarama.SyncProducer
+	c config
+}
+
+// NewSyncProducer wraps p.
+func NewSyncProducer(p sarama.SyncProducer, opts ...Option) *SyncProducer {
+	return &SyncProducer{SyncProducer: p, c: newConfig(opts)}
+}
+
+// SendMessage sends msg without a parent span. Use SendMessageContext to
+// continue a trace.
+func (p *SyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return p.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessages sends msgs without a parent span. Use SendMessagesContext to
+// continue a trace.
+func (p *SyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return p.SendMessagesContext(context.Background(), msgs)
+}
+
+// SendMessageContext sends msg like sarama.SyncProducer.SendMessage, with a
+// producer span that is a child of the span in ctx.
+func (p *SyncProducer) SendMessageContext(ctx context.Context, msg *sarama.ProducerMessage) (int32, int64, error) {
+	span := p.startSpan(ctx, msg)
+	partition, offset, err := p.SyncProducer.SendMessage(msg)
+	if err == nil {
+		setSentAttributes(span, partition, offset)
+	}
+	finishSpan(span, err)
+	return partition, offset, err
+}
+
+// SendMessagesContext sends msgs like sarama.SyncProducer.SendMessages, with
+// producer spans that are children of the span in ctx.
+func (p *SyncProducer) SendMessagesContext(ctx context.Context, msgs []*sarama.ProducerMessage) error {
+	spans := make([]trace.Span, len(msgs))
+	for i, msg := range msgs {
+		spans[i] = p.startSpan(ctx, msg)
+	}
+
+	err := p.SyncProducer.SendMessages(msgs)
+	var producerErrors sarama.ProducerErrors
+	failed := make(map[*sarama.ProducerMessage]error)
+	perMessage := errors.As(err, &producerErrors)
+	for _, e := range producerErrors {
+		failed[e.Msg] = e.Err
+	}
+	for i, span := range spans {
+		msgErr := err
+		if perMessage {
+			msgErr = failed[msgs[i]]
+		}
+		if msgErr == nil {
+			setSentAttributes(span, msgs[i].Partition, msgs[i].Offset)
+		}
+		finishSpan(span, msgErr)
+	}
+	return err
+}
+
+func (p *SyncProducer) startSpan(ctx context.Context, msg *sarama.ProducerMessage) trace.Span {
+	return p.c.startSaramaSpan(ctx, msg)
+}
+
+// startSaramaSpan starts the producer span of msg and records its size.
+func (c config) startSaramaSpan(ctx context.Context, msg *sarama.ProducerMessage) trace.Span {
+	size := 0
+	if msg.Value != nil {
+		size = msg.Value.Length()
+	}
+	_, span := tracker.StartProducerSpan(ctx, system, msg.Topic, saramaHeaders{&msg.Headers},
+		trace.WithAttributes(c.attributes...),
+		trace.WithAttributes(attribute.Int("messaging.message.body.size", size)))
+	c.recordSent(ctx, msg.Topic, size)
+	return span
+}
+
+// AsyncProducer is a sarama producer creating a producer span for each
+// message and injecting its context into the message headers. The span of
+// a message ends when the producer returns it on Successes or Errors, or,
+// unless both Producer.Return.Successes and Producer.Return.Errors are set,
+// once it is handed to the producer.
+type AsyncProducer struct {
+	sarama.AsyncProducer
+	c config
+	// returned is set when the producer returns every message, on
+	// Successes or Errors. Otherwise the span of a failed message would
+	// never end.
+	returned  bool
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	spans     sync.Map // *sarama.ProducerMessage -> trace.Span
+	closeOnce sync.Once
+}
+
+// NewAsyncProducer wraps p, created with conf.
+//
+//	producer := mwkafka.NewAsyncProducer(asyncProducer, conf)
+//	producer.SendMessageContext(ctx, &sarama.ProducerMessage{Topic: "orders", Value: sarama.ByteEncoder(order)})
+func NewAsyncProducer(p sarama.AsyncProducer, conf *sarama.Config, opts ...Option) *AsyncProducer {
+	ap := &AsyncProducer{
+		AsyncProducer: p,
+		c:             newConfig(opts),
+		returned:      conf.Producer.Return.Successes && conf.Producer.Return.Errors,
+		input:         make(chan *sarama.ProducerMessage),
+		successes:     make(chan *sarama.ProducerMessage),
+		errors:        make(chan *sarama.ProducerError),
+	}
+	go func() {
+		for msg := range ap.input {
+			ap.SendMessageContext(context.Background(), msg)
+		}
+		p.AsyncClose()
+	}()
+	go func() {
+		for msg := range p.Successes() {
+			if span, ok := ap.spans.LoadAndDelete(msg); ok {
+				setSentAttributes(span.(trace.Span), msg.Partition, msg.Offset)
+				finishSpan(span.(trace.Span), nil)
+			}
+			ap.successes <- msg
+		}
+		close(ap.successes)
+	}()
+	go func() {
+		for e := range p.Errors() {
+			if span, ok := ap.spans.LoadAndDelete(e.Msg); ok {
+				finishSpan(span.(trace.Span), e.Err)
+			}
+			ap.errors <- e
+		}
+		close(ap.errors)
+	}()
+	return ap
+}
+
+// Input returns the input channel of the producer. Messages sent on it get
+// a producer span without a parent; use SendMessageContext to continue a
+// trace.
+func (p *AsyncProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+// SendMessageContext sends msg on the input channel of the wrapped
+// producer, with a producer span that is a child of the span in ctx.
+func (p *AsyncProducer) SendMessageContext(ctx context.Context, msg *sarama.ProducerMessage) {
+	span := p.c.startSaramaSpan(ctx, msg)
+	if p.returned {
+		p.spans.Store(msg, span)
+		p.AsyncProducer.Input() <- msg
+		return
+	}
+	p.AsyncProducer.Input() <- msg
+	span.End()
+}
+
+func (p *AsyncProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+func (p *AsyncProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+// AsyncClose closes the producer like sarama.AsyncProducer.AsyncClose, once
+// the messages sent on Input are handed to the wrapped producer.
+func (p *AsyncProducer) AsyncClose() {
+	p.closeOnce.Do(func() { close(p.input) })
+}
+
+// Close closes the producer like sarama.AsyncProducer.Close.
+func (p *AsyncProducer) Close() error {
+	p.AsyncClose()
+	go func() {
+		for range p.successes {
+		}
+	}()
+	var errs sarama.ProducerErrors
+	for e := range p.errors {
+		errs = append(errs, e)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// setSentAttributes sets the partition and offset a message was written to.
+func setSentAttributes(span trace.Span, partition int32, offset int64) {
+	span.SetAttributes(
+		attribute.String("messaging.destination.partition.id", strconv.Itoa(int(partition))),
+		attribute.Int64("messaging.kafka.message.offset", offset),
+	)
+}
+
+// ConsumerGroupHandler is a sarama.ConsumerGroupHandler calling a function
+// with a consumer span for each message of its claims.
+type ConsumerGroupHandler struct {
+	handle func(ctx context.Context, msg *sarama.ConsumerMessage) error
+	c      config
+}
+
+// NewConsumerGroupHandler returns a handler calling handle for each
+// message, with a consumer span that is a child of the producer span, and
+// recording the size, partition lag and processing duration of the
+// message. The message is marked once handle returns nil; otherwise
+// ConsumeClaim returns the error, which ends the session so that the
+// message is consumed again.
+//
+//	handler := mwkafka.NewConsumerGroupHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+//		return handle(ctx, msg)
+//	}, mwkafka.WithConsumerGroup("billing"))
+//	err := group.Consume(ctx, []string{"orders"}, handler)
+func NewConsumerGroupHandler(handle func(ctx context.Context, msg *sarama.ConsumerMessage) error, opts ...Option) *ConsumerGroupHandler {
+	return &ConsumerGroupHandler{handle: handle, c: newConfig(opts)}
+}
+
+func (h *ConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *ConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim handles the messages of claim until the claim is closed or
+// the session ends, e.g. on a rebalance.
+func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			err := h.c.processMessage(session.Context(), claim, msg, func(ctx context.Context) error {
+				return h.handle(ctx, msg)
+			})
+			if err != nil {
+				return err
+			}
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// ProcessMessage calls fn with a consumer span for msg, a child of the
+// producer span, and records the size, partition lag and processing
+// duration of the message. Call it from the ConsumeClaim method of a
+// sarama.ConsumerGroupHandler when NewConsumerGroupHandler does not fit;
+// claim may be nil when the lag is not wanted.
+//
+//	for msg := range claim.Messages() {
+//		err := mwkafka.ProcessMessage(session.Context(), claim, msg, func(ctx context.Context) error {
+//			return handle(ctx, msg)
+//		}, mwkafka.WithConsumerGroup("billing"))
+//		...
+//		session.MarkMessage(msg, "")
+//	}
+func ProcessMessage(ctx context.Context, claim sarama.ConsumerGroupClaim, msg *sarama.ConsumerMessage, fn func(context.Context) error, opts ...Option) error {
+	return newConfig(opts).processMessage(ctx, claim, msg, fn)
+}
+
+func (c config) processMessage(ctx context.Context, claim sarama.ConsumerGroupClaim, msg *sarama.ConsumerMessage, fn func(context.Context) error) error {
+	start := time.Now()
+	c.recordReceived(ctx, msg.Topic, msg.Partition, msg.Offset, highWaterMark(claim), len(msg.Value))
+	ctx, span := tracker.StartConsumerSpan(ctx, system, msg.Topic, saramaConsumerHeaders(msg.Headers),
+		trace.WithAttributes(c.messageAttributes(msg.Partition, msg.Offset, len(msg.Value))...))
+	err := fn(ctx)
+	c.finishProcess(ctx, span, msg.Topic, start, err)
+	return err
+}
+
+// ProcessMessages calls fn with one consumer span for msgs, linked to the
+// producer span of each message, and records their size, the partition lag
+// and the processing duration of the batch. The batch is attributed to the
+// topic of its messages, or to no topic when they come from several.
+func ProcessMessages(ctx context.Context, claim sarama.ConsumerGroupClaim, msgs []*sarama.ConsumerMessage, fn func(context.Context) error, opts ...Option) error {
+	if len(msgs) == 0 {
+		return fn(ctx)
+	}
+	c := newConfig(opts)
+	start := time.Now()
+	carriers := make([]saramaConsumerHeaders, len(msgs))
+	topic := msgs[0].Topic
+	for i, msg := range msgs {
+		c.recordReceived(ctx, msg.Topic, msg.Partition, msg.Offset, highWaterMark(claim), len(msg.Value))
+		carriers[i] = saramaConsumerHeaders(msg.Headers)
+		if msg.Topic != topic {
+			topic = ""
+		}
+	}
+	ctx, span := tracker.StartBatchConsumerSpan(ctx, system, topic, carriers,
+		trace.WithAttributes(c.batchAttributes()...))
+	err := fn(ctx)
+	c.finishProcess(ctx, span, topic, start, err)
+	return err
+}
+
+func highWaterMark(claim sarama.ConsumerGroupClaim) int64 {
+	if claim == nil {
+		return -1
+	}
+	return claim.HighWaterMarkOffset()
+}
+
+// saramaHeaders adapts the headers of a sarama producer message.
+type saramaHeaders struct {
+	headers *[]sarama.RecordHeader
+}
+
+func (h saramaHeaders) Get(key string) string {
+	for _, header := range *h.headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h saramaHeaders) Set(key, value string) {
+	for i, header := range *h.headers {
+		if string(header.Key) == key {
+			(*h.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*h.headers = append(*h.headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (h saramaHeaders) Keys() []string {
+	keys := make([]string, len(*h.headers))
+	for i, header := range *h.headers {
+		keys[i] = string(header.Key)
+	}
+	return keys
+}
+
+// saramaConsumerHeaders adapts the headers of a sarama consumer message for
+// extraction.
+type saramaConsumerHeaders []*sarama.RecordHeader
+
+func (h saramaConsumerHeaders) Get(key string) string {
+	for _, header := range h {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h saramaConsumerHeaders) Set(string, string) {}
+
+func (h saramaConsumerHeaders) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for _, header := range h {
+		if header != nil {
+			keys = append(keys, string(header.Key))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,275 @@
+package mwkafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withTestProviders installs a tracer provider recording spans and the W3C
+// trace context propagator until the end of the test.
+func withTestProviders(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousTp, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousTp)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+func hasHeader(msg *sarama.ProducerMessage, key string) bool {
+	return saramaHeaders{&msg.Headers}.Get(key) != ""
+}
+
+func TestSyncProducer(t *testing.T) {
+	exporter := withTestProviders(t)
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if !hasHeader(msg, "traceparent") {
+			return errors.New("no traceparent header")
+		}
+		return nil
+	})
+	mock.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	p := NewSyncProducer(mock)
+	defer p.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	if _, _, err := p.SendMessageContext(ctx, &sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("order")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.SendMessage(&sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("order")}); err == nil {
+		t.Fatal("SendMessage succeeded, want the error of the mock")
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	if spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("producer span is not a child of the span in the context")
+	}
+	if spans[1].Status.Code != codes.Error {
+		t.Errorf("status of the failed message = %v, want an error", spans[1].Status)
+	}
+}
+
+func TestAsyncProducer(t *testing.T) {
+	exporter := withTestProviders(t)
+	conf := mocks.NewTestConfig()
+	conf.Producer.Return.Successes = true
+	mock := mocks.NewAsyncProducer(t, conf)
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+	p := NewAsyncProducer(mock, conf)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	p.SendMessageContext(ctx, &sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("order")})
+	p.Input() <- &sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("order")}
+	parent.End()
+
+	msg := <-p.Successes()
+	if !hasHeader(msg, "traceparent") {
+		t.Error("no traceparent header")
+	}
+	if e := <-p.Errors(); !errors.Is(e.Err, sarama.ErrOutOfBrokers) {
+		t.Errorf("error = %v, want %v", e.Err, sarama.ErrOutOfBrokers)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var producerSpans int
+	for _, span := range exporter.GetSpans() {
+		if span.SpanKind != trace.SpanKindProducer {
+			continue
+		}
+		producerSpans++
+		// Only the message sent with SendMessageContext has a parent, and
+		// the mock fails the second message.
+		if span.Parent.SpanID() == parent.SpanContext().SpanID() {
+			if span.Status.Code == codes.Error {
+				t.Errorf("status of the sent message = %v, want unset", span.Status)
+			}
+		} else if span.Status.Code != codes.Error {
+			t.Errorf("status of the failed message = %v, want an error", span.Status)
+		}
+	}
+	if producerSpans != 2 {
+		t.Fatalf("got %d producer spans, want 2", producerSpans)
+	}
+}
+
+func TestAsyncProducerWithoutReturnErrors(t *testing.T) {
+	exporter := withTestProviders(t)
+	conf := mocks.NewTestConfig()
+	conf.Producer.Return.Successes = true
+	conf.Producer.Return.Errors = false
+	mock := mocks.NewAsyncProducer(t, conf)
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+	p := NewAsyncProducer(mock, conf)
+
+	p.SendMessageContext(context.Background(), &sarama.ProducerMessage{Topic: "orders"})
+	p.SendMessageContext(context.Background(), &sarama.ProducerMessage{Topic: "orders"})
+	<-p.Successes()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failure is never returned, so both spans end once the messages
+	// are handed to the producer.
+	if spans := exporter.GetSpans(); len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+}
+
+// fakeSession is a consumer group session recording the marked messages.
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+func (c fakeClaim) HighWaterMarkOffset() int64               { return 10 }
+
+func TestConsumerGroupHandler(t *testing.T) {
+	exporter := withTestProviders(t)
+	producer := &sarama.ProducerMessage{Topic: "orders"}
+	producerCtx, producerSpan := otel.Tracer("test").Start(context.Background(), "publish")
+	otel.GetTextMapPropagator().Inject(producerCtx, saramaHeaders{&producer.Headers})
+	producerSpan.End()
+	exporter.Reset()
+
+	headers := make([]*sarama.RecordHeader, len(producer.Headers))
+	for i := range producer.Headers {
+		headers[i] = &producer.Headers[i]
+	}
+	claim := fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 1, Headers: headers}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 2}
+	close(claim.messages)
+
+	errHandle := errors.New("cannot handle")
+	h := NewConsumerGroupHandler(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			t.Error("no span in the context")
+		}
+		if msg.Offset == 2 {
+			return errHandle
+		}
+		return nil
+	}, WithConsumerGroup("billing"))
+	session := &fakeSession{}
+	if err := h.ConsumeClaim(session, claim); !errors.Is(err, errHandle) {
+		t.Fatalf("ConsumeClaim = %v, want the error of the handler", err)
+	}
+	if len(session.marked) != 1 || session.marked[0] != 1 {
+		t.Errorf("marked offsets %v, want [1]", session.marked)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].SpanContext.TraceID() != producerSpan.SpanContext().TraceID() {
+		t.Error("consumer span does not continue the producer's trace")
+	}
+	if spans[1].Status.Code != codes.Error {
+		t.Errorf("status of the failed message = %v, want an error", spans[1].Status)
+	}
+}
+
+func TestConsumeClaimStopsWithSession(t *testing.T) {
+	withTestProviders(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+	// The claim stays open, as it does while a rebalance is pending.
+	claim := fakeClaim{messages: make(chan *sarama.ConsumerMessage)}
+	h := NewConsumerGroupHandler(func(context.Context, *sarama.ConsumerMessage) error { return nil })
+
+	done := make(chan error, 1)
+	go func() { done <- h.ConsumeClaim(session, claim) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ConsumeClaim = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConsumeClaim did not return when the session ended")
+	}
+}
+
+func TestProcessMessagesTopics(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		topics   []string
+		wantName string
+		wantDest string
+	}{
+		{name: "single topic", topics: []string{"orders", "orders"}, wantName: "process orders", wantDest: "orders"},
+		{name: "several topics", topics: []string{"orders", "refunds"}, wantName: "process"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := withTestProviders(t)
+			msgs := make([]*sarama.ConsumerMessage, len(tt.topics))
+			for i, topic := range tt.topics {
+				msgs[i] = &sarama.ConsumerMessage{Topic: topic, Offset: int64(i)}
+			}
+			claim := fakeClaim{}
+			if err := ProcessMessages(context.Background(), claim, msgs, func(context.Context) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			if spans[0].Name != tt.wantName {
+				t.Errorf("span name = %q, want %q", spans[0].Name, tt.wantName)
+			}
+			var dest string
+			for _, kv := range spans[0].Attributes {
+				if kv.Key == "messaging.destination.name" {
+					dest = kv.Value.AsString()
+				}
+			}
+			if dest != tt.wantDest {
+				t.Errorf("messaging.destination.name = %q, want %q", dest, tt.wantDest)
+			}
+		})
+	}
+}
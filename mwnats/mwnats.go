@@ -0,0 +1,245 @@
+// Package mwnats instruments NATS publishers and subscribers of nats.go with
+// the providers and propagators configured by tracker.Track.
+package mwnats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/middleware-labs/golang-apm/mwnats"
+
+// system is the messaging.system of every span and metric.
+const system = "nats"
+
+type config struct {
+	attributes []attribute.KeyValue
+}
+
+type Option interface {
+	apply(config) config
+}
+
+type optFunc func(config) config
+
+func (f optFunc) apply(c config) config { return f(c) }
+
+// WithAttributes adds attributes to every span.
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return optFunc(func(c config) config {
+		c.attributes = append(c.attributes, attributes...)
+		return c
+	})
+}
+
+func newConfig(options []Option) config {
+	var c config
+	for _, opt := range options {
+		c = opt.apply(c)
+	}
+	return c
+}
+
+// Publish publishes msg on nc like nats.Conn.PublishMsg, with a producer span
+// whose context is injected into the message headers. The headers of msg are
+// copied, not modified.
+//
+//	err := mwnats.Publish(ctx, nc, &nats.Msg{Subject: "orders.created", Data: order})
+func Publish(ctx context.Context, nc *nats.Conn, msg *nats.Msg, opts ...Option) error {
+	msg, span := startProducerSpan(ctx, msg, newConfig(opts))
+	err := nc.PublishMsg(msg)
+	finishSpan(span, err)
+	return err
+}
+
+// PublishJetStream publishes msg on js like nats.JetStreamContext.PublishMsg,
+// with a producer span whose context is injected into the message headers.
+// The time until the stream acknowledges the message is recorded as the
+// confirm latency. The headers of msg are copied, not modified.
+func PublishJetStream(ctx context.Context, js nats.JetStreamContext, msg *nats.Msg, opts ...Option) (*nats.PubAck, error) {
+	msg, span := startProducerSpan(ctx, msg, newConfig(opts))
+	start := time.Now()
+	ack, err := js.PublishMsg(msg, nats.Context(ctx))
+	attributes := []attribute.KeyValue{
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", msg.Subject),
+	}
+	if err != nil {
+		attributes = append(attributes, attribute.String("error.type", fmt.Sprintf("%T", err)))
+	}
+	instrumentsFor().confirm.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+	if err == nil {
+		span.SetAttributes(
+			attribute.String("messaging.nats.stream", ack.Stream),
+			attribute.Int64("messaging.nats.message.sequence", int64(ack.Sequence)),
+		)
+	}
+	finishSpan(span, err)
+	return ack, err
+}
+
+// startProducerSpan starts the producer span of msg and returns a copy of msg
+// with the span context injected into a copy of its headers.
+func startProducerSpan(ctx context.Context, msg *nats.Msg, c config) (*nats.Msg, trace.Span) {
+	header := make(nats.Header, len(msg.Header)+1)
+	for k, v := range msg.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	msg = &nats.Msg{Subject: msg.Subject, Reply: msg.Reply, Header: header, Data: msg.Data}
+	_, span := tracker.StartProducerSpan(ctx, system, msg.Subject, headerCarrier(msg.Header),
+		trace.WithAttributes(attribute.Int("messaging.message.body.size", len(msg.Data))),
+		trace.WithAttributes(c.attributes...))
+	return msg, span
+}
+
+// NextMsg waits for the next message of a synchronous or pull subscription
+// like nats.Subscription.NextMsgWithContext, with a receive span linked to the
+// producer span of the message. Redeliveries are counted by Process.
+func NextMsg(ctx context.Context, sub *nats.Subscription, opts ...Option) (*nats.Msg, error) {
+	c := newConfig(opts)
+	_, span := tracker.StartReceiveSpan(ctx, system, sub.Subject, trace.WithAttributes(c.attributes...))
+	msg, err := sub.NextMsgWithContext(ctx)
+	if err == nil {
+		tracker.AddProducerLink(span, headerCarrier(msg.Header))
+		span.SetAttributes(messageAttributes(msg)...)
+	}
+	finishSpan(span, err)
+	return msg, err
+}
+
+// Handler returns a message handler for nats.Conn.Subscribe,
+// QueueSubscribe or JetStream subscriptions that calls fn through Process.
+//
+//	nc.Subscribe("orders.*", mwnats.Handler(func(ctx context.Context, msg *nats.Msg) error {
+//		return handle(ctx, msg)
+//	}))
+func Handler(fn func(context.Context, *nats.Msg) error, opts ...Option) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		_ = Process(context.Background(), msg, func(ctx context.Context) error {
+			return fn(ctx, msg)
+		}, opts...)
+	}
+}
+
+// Process calls fn with a consumer span for msg, a child of the producer
+// span, and records the processing duration. JetStream messages delivered
+// more than once are counted as redeliveries.
+func Process(ctx context.Context, msg *nats.Msg, fn func(context.Context) error, opts ...Option) error {
+	c := newConfig(opts)
+	start := time.Now()
+	ctx, span := tracker.StartConsumerSpan(ctx, system, msg.Subject, headerCarrier(msg.Header),
+		trace.WithAttributes(c.attributes...))
+	span.SetAttributes(messageAttributes(msg)...)
+	recordRedelivery(ctx, msg)
+	err := fn(ctx)
+	finishSpan(span, err)
+	instrumentsFor().duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", msg.Subject),
+		attribute.String("messaging.operation.type", "process"),
+	))
+	return err
+}
+
+// messageAttributes returns the attributes of a received message.
+func messageAttributes(msg *nats.Msg) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.Int("messaging.message.body.size", len(msg.Data))}
+	if msg.Sub != nil && msg.Sub.Queue != "" {
+		attributes = append(attributes, attribute.String("messaging.consumer.group.name", msg.Sub.Queue))
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		// Not a JetStream message.
+		return attributes
+	}
+	return append(attributes,
+		attribute.String("messaging.nats.stream", meta.Stream),
+		attribute.String("messaging.nats.consumer", meta.Consumer),
+		attribute.Int64("messaging.nats.message.sequence", int64(meta.Sequence.Stream)),
+		attribute.Int64("messaging.nats.message.delivery_count", int64(meta.NumDelivered)),
+	)
+}
+
+// recordRedelivery counts msg as a redelivery when JetStream delivered it
+// before.
+func recordRedelivery(ctx context.Context, msg *nats.Msg) {
+	meta, err := msg.Metadata()
+	if err != nil || meta.NumDelivered <= 1 {
+		return
+	}
+	instrumentsFor().redeliveries.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.nats.stream", meta.Stream),
+		attribute.String("messaging.nats.consumer", meta.Consumer),
+	))
+}
+
+func finishSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// headerCarrier adapts NATS message headers for propagation.
+type headerCarrier nats.Header
+
+func (h headerCarrier) Get(key string) string {
+	return nats.Header(h).Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	if h != nil {
+		nats.Header(h).Set(key, value)
+	}
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// instruments are the NATS metrics of one meter provider.
+type instruments struct {
+	confirm      metric.Float64Histogram
+	duration     metric.Float64Histogram
+	redeliveries metric.Int64Counter
+}
+
+var instrumentsCache sync.Map // metric.MeterProvider -> *instruments
+
+// instrumentsFor returns the instruments of the tracker's meter provider.
+// They are created again once the tracker's meter provider replaces the
+// global one.
+func instrumentsFor() *instruments {
+	mp := tracker.ActiveMeterProvider()
+	if i, ok := instrumentsCache.Load(mp); ok {
+		return i.(*instruments)
+	}
+	meter := mp.Meter(instrumentationName)
+	var i instruments
+	i.confirm, _ = meter.Float64Histogram("messaging.nats.publish.confirm.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time taken by JetStream to acknowledge a published message."))
+	i.duration, _ = meter.Float64Histogram("messaging.process.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of processing a message."))
+	i.redeliveries, _ = meter.Int64Counter("messaging.nats.redeliveries",
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of JetStream messages delivered more than once."))
+	actual, _ := instrumentsCache.LoadOrStore(mp, &i)
+	return actual.(*instruments)
+}
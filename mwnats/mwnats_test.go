@@ -0,0 +1,202 @@
+package mwnats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// runServer starts an embedded NATS server with JetStream and returns a
+// connection to it.
+func runServer(t *testing.T) *nats.Conn {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+// withTestProviders installs providers recording spans and metrics, and the
+// W3C trace context propagator, until the end of the test.
+func withTestProviders(t *testing.T) (*tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	previousTp, previousMp, previousPropagator := otel.GetTracerProvider(), otel.GetMeterProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousTp)
+		otel.SetMeterProvider(previousMp)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter, reader
+}
+
+// counterValue returns the sum of the data points of an int64 counter.
+func counterValue(t *testing.T, reader *sdkmetric.ManualReader, name string) int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == name {
+				for _, dp := range sum.DataPoints {
+					total += dp.Value
+				}
+			}
+		}
+	}
+	return total
+}
+
+func TestPublishAndHandler(t *testing.T) {
+	withTestProviders(t)
+	nc := runServer(t)
+
+	processed := make(chan context.Context, 1)
+	if _, err := nc.Subscribe("orders.*", Handler(func(ctx context.Context, msg *nats.Msg) error {
+		processed <- ctx
+		return nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	msg := &nats.Msg{Subject: "orders.created", Data: []byte("order")}
+	if err := Publish(ctx, nc, msg); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+	if msg.Header != nil {
+		t.Errorf("headers of the message were modified: %v", msg.Header)
+	}
+
+	select {
+	case ctx := <-processed:
+		if trace.SpanContextFromContext(ctx).TraceID() != parent.SpanContext().TraceID() {
+			t.Error("process span does not continue the producer's trace")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not processed")
+	}
+}
+
+func TestJetStreamRedeliveriesCountedOnce(t *testing.T) {
+	_, reader := withTestProviders(t)
+	nc := runServer(t)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	header := nats.Header{"Source": []string{"test"}}
+	ack, err := PublishJetStream(context.Background(), js, &nats.Msg{Subject: "orders.created", Header: header, Data: []byte("order")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Stream != "ORDERS" {
+		t.Errorf("stream = %q, want ORDERS", ack.Stream)
+	}
+	if len(header) != 1 {
+		t.Errorf("headers of the message were modified: %v", header)
+	}
+
+	sub, err := js.SubscribeSync("orders.>", nats.Durable("billing"), nats.AckExplicit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := NextMsg(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("traceparent") == "" {
+		t.Error("no traceparent header")
+	}
+	if err := msg.Nak(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = NextMsg(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counterValue(t, reader, "messaging.nats.redeliveries"); got != 0 {
+		t.Errorf("NextMsg counted %d redeliveries, want 0", got)
+	}
+	if err := Process(ctx, msg, func(context.Context) error { return msg.Ack() }); err != nil {
+		t.Fatal(err)
+	}
+	if got := counterValue(t, reader, "messaging.nats.redeliveries"); got != 1 {
+		t.Errorf("counted %d redeliveries, want 1", got)
+	}
+}
+
+func TestPublishJetStreamConfirmErrorType(t *testing.T) {
+	_, reader := withTestProviders(t)
+	nc := runServer(t)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No stream captures the subject.
+	if _, err := PublishJetStream(context.Background(), js, &nats.Msg{Subject: "refunds.created"}); err == nil {
+		t.Fatal("PublishJetStream without a stream succeeded")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var points int
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			histogram, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok || m.Name != "messaging.nats.publish.confirm.duration" {
+				continue
+			}
+			for _, dp := range histogram.DataPoints {
+				points++
+				if v, ok := dp.Attributes.Value("error.type"); !ok || v.AsString() == "" {
+					t.Error("no error.type on the failed confirmation")
+				}
+				if dp.Attributes.HasValue("error") {
+					t.Error("unexpected error attribute")
+				}
+			}
+		}
+	}
+	if points != 1 {
+		t.Errorf("got %d confirm data points, want 1", points)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs/otlplogsgrpc"
 	sdk "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
 	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/attribute"
@@ -29,6 +30,22 @@ func newResource(config *tracker.Config) *resource.Resource {
 	)
 }
 
+// contextHook adds the attributes attached with tracker.WithAttributes to
+// the event before handing it to the OpenTelemetry hook, which reads them
+// back from the event's fields.
+type contextHook struct {
+	next zerolog.Hook
+}
+
+func (h contextHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if ctx := e.GetCtx(); ctx != nil {
+		for _, kv := range tracker.AttributesFromContext(ctx) {
+			e.Interface(string(kv.Key), kv.Value.AsInterface())
+		}
+	}
+	h.next.Run(e, level, msg)
+}
+
 func NewMWOTelHook(config *tracker.Config) *otelzerolog.Hook {
 	ctx := context.Background()
 	exporter, _ := otlplogs.NewExporter(ctx, otlplogs.WithClient(otlplogsgrpc.NewClient(otlplogsgrpc.WithEndpoint(config.Host))))
@@ -39,3 +56,9 @@ func NewMWOTelHook(config *tracker.Config) *otelzerolog.Hook {
 
 	return otelzerolog.NewHook(loggerProvider)
 }
+
+// NewMWOTelContextHook is like NewMWOTelHook, and also adds the attributes
+// attached to the event's context with tracker.WithAttributes.
+func NewMWOTelContextHook(config *tracker.Config) zerolog.Hook {
+	return contextHook{next: NewMWOTelHook(config)}
+}
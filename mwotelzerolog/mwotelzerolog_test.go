@@ -0,0 +1,59 @@
+package mwotelzerolog
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/agoda-com/opentelemetry-go/otelzerolog"
+	sdk "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/rs/zerolog"
+)
+
+// recordingExporter keeps the exported log records in memory.
+type recordingExporter struct {
+	mu      sync.Mutex
+	records []sdk.ReadableLogRecord
+}
+
+func (e *recordingExporter) Export(_ context.Context, batch []sdk.ReadableLogRecord) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records = append(e.records, batch...)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(context.Context) error { return nil }
+
+func TestContextHook(t *testing.T) {
+	exporter := &recordingExporter{}
+	hook := contextHook{next: otelzerolog.NewHook(sdk.NewLoggerProvider(sdk.WithSyncer(exporter)))}
+	logger := zerolog.New(io.Discard).Hook(hook)
+
+	ctx := tracker.WithAttributes(context.Background(), tracker.String("tenant.id", "acme"), tracker.Int("shard", 3))
+	logger.Info().Ctx(ctx).Str("order.id", "o-1").Msg("order placed")
+	logger.Info().Msg("no context")
+
+	if len(exporter.records) != 2 {
+		t.Fatalf("got %d log records, want 2", len(exporter.records))
+	}
+	// The OpenTelemetry hook reads the fields back from the event buffer,
+	// so the context attributes arrive as regular fields.
+	got := map[string]string{}
+	for _, kv := range *exporter.records[0].Attributes() {
+		got[string(kv.Key)] = kv.Value.Emit()
+	}
+	want := map[string]string{"tenant.id": "acme", "shard": "3", "order.id": "o-1"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	for _, kv := range *exporter.records[1].Attributes() {
+		if kv.Key == "tenant.id" {
+			t.Error("event without a context has the context attributes")
+		}
+	}
+}
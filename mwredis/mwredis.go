@@ -0,0 +1,253 @@
+// Package mwredis instruments go-redis clients with the providers
+// configured by tracker.Track.
+package mwredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/middleware-labs/golang-apm/tracker/sanitize"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/middleware-labs/golang-apm/mwredis"
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	attributes     []attribute.KeyValue
+}
+
+type Option interface {
+	apply(config) config
+}
+
+type optFunc func(config) config
+
+func (f optFunc) apply(c config) config { return f(c) }
+
+// WithAttributes adds attributes to every span and metric of the client.
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return optFunc(func(c config) config {
+		c.attributes = append(c.attributes, attributes...)
+		return c
+	})
+}
+
+func newConfig(cfg *tracker.Config, options []Option) config {
+	var c config
+	for _, opt := range options {
+		c = opt.apply(c)
+	}
+
+	// Without a config the tracker's provider is looked up for each command,
+	// so that clients instrumented before Track still report.
+	if cfg != nil && cfg.Tp != nil {
+		c.tracerProvider = cfg.Tp
+	}
+
+	return c
+}
+
+func (c config) tracer() trace.Tracer {
+	if c.tracerProvider != nil {
+		return c.tracerProvider.Tracer(instrumentationName)
+	}
+	return tracker.ActiveTracerProvider().Tracer(instrumentationName)
+}
+
+// Instrument adds a hook to rdb creating a span for each command and
+// pipeline, and reports the connection pool statistics of rdb until stop is
+// called or rdb answers a command with redis.ErrClosed. The spans of
+// cluster and ring clients get the address of the node serving the command.
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	stop := mwredis.Instrument(rdb, config)
+//	defer func() {
+//		stop()
+//		rdb.Close()
+//	}()
+func Instrument(rdb redis.UniversalClient, cfg *tracker.Config, opts ...Option) (stop func()) {
+	c := newConfig(cfg, opts)
+	attributes := append([]attribute.KeyValue{attribute.String("db.system", "redis")}, c.attributes...)
+	switch client := rdb.(type) {
+	case *redis.Client:
+		attributes = append(attributes, serverAttributes(client.Options())...)
+	case *redis.ClusterClient:
+		// Nodes are created on first use. Those that already exist are
+		// hooked before registering OnNewNode, which would otherwise hook
+		// again the nodes created while ForEachShard loads the cluster
+		// state.
+		client.ForEachShard(context.Background(), func(_ context.Context, node *redis.Client) error {
+			addNodeHook(node)
+			return nil
+		})
+		client.OnNewNode(addNodeHook)
+	case *redis.Ring:
+		client.OnNewNode(addNodeHook)
+		client.ForEachShard(context.Background(), func(_ context.Context, shard *redis.Client) error {
+			addNodeHook(shard)
+			return nil
+		})
+	}
+
+	rdb.AddHook(hook{c: c, rdb: rdb, attributes: attributes})
+	recordStats(rdb, attribute.NewSet(attributes...))
+	return func() { statsClients.Delete(rdb) }
+}
+
+// serverAttributes returns the address and database of a client of a single
+// node.
+func serverAttributes(opts *redis.Options) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.Int("db.redis.database_index", opts.DB)}
+	host, port, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		return append(attributes, attribute.String("server.address", opts.Addr))
+	}
+	attributes = append(attributes, attribute.String("server.address", host))
+	if n, err := strconv.Atoi(port); err == nil {
+		attributes = append(attributes, attribute.Int("server.port", n))
+	}
+	return attributes
+}
+
+type hook struct {
+	c          config
+	rdb        redis.UniversalClient
+	attributes []attribute.KeyValue
+}
+
+func (h hook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		operation := strings.ToUpper(cmd.FullName())
+		ctx, span := h.c.tracer().Start(ctx, operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(h.attributes...),
+			trace.WithAttributes(
+				attribute.String("db.operation", operation),
+				attribute.String("db.statement", statement(cmd)),
+			),
+		)
+		err := next(ctx, cmd)
+		h.finish(ctx, span, operation, start, err)
+		return err
+	}
+}
+
+func (h hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		statements := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			statements[i] = statement(cmd)
+		}
+		ctx, span := h.c.tracer().Start(ctx, "pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(h.attributes...),
+			trace.WithAttributes(
+				attribute.String("db.operation", "pipeline"),
+				attribute.String("db.statement", strings.Join(statements, "\n")),
+				attribute.Int("db.redis.pipeline_length", len(cmds)),
+			),
+		)
+		err := next(ctx, cmds)
+		h.finish(ctx, span, "pipeline", start, err)
+		return err
+	}
+}
+
+// addNodeHook adds a nodeHook to a node of a cluster or ring client.
+func addNodeHook(node *redis.Client) {
+	node.AddHook(nodeHook{attributes: serverAttributes(node.Options())})
+}
+
+// nodeHook sets the address of a node of a cluster or ring client on the
+// spans of the commands it serves. The hook of the client creating the span
+// runs first.
+type nodeHook struct {
+	attributes []attribute.KeyValue
+}
+
+func (h nodeHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h nodeHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		trace.SpanFromContext(ctx).SetAttributes(h.attributes...)
+		return next(ctx, cmd)
+	}
+}
+
+func (h nodeHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		trace.SpanFromContext(ctx).SetAttributes(h.attributes...)
+		return next(ctx, cmds)
+	}
+}
+
+// finish sets the status of span from err, ends it and records the command
+// duration. A missing key, redis.Nil, is not an error.
+func (h hook) finish(ctx context.Context, span trace.Span, operation string, start time.Time, err error) {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+	span.End()
+
+	if errors.Is(err, redis.ErrClosed) {
+		statsClients.Delete(h.rdb)
+	}
+	registerStats()
+	attributes := append(append([]attribute.KeyValue(nil), h.attributes...), attribute.String("db.operation", operation))
+	durationFor().Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+}
+
+// statement returns the sanitized command line of cmd.
+func statement(cmd redis.Cmder) string {
+	args := cmd.Args()
+	values := make([]string, len(args))
+	for i, arg := range args {
+		switch a := arg.(type) {
+		case string:
+			values[i] = a
+		case []byte:
+			values[i] = string(a)
+		default:
+			values[i] = fmt.Sprint(a)
+		}
+	}
+	return sanitize.Redis(values)
+}
+
+var durations sync.Map // metric.MeterProvider -> metric.Float64Histogram
+
+// durationFor returns the command duration histogram of the tracker's meter
+// provider. It is created again once the tracker's meter provider replaces
+// the global one.
+func durationFor() metric.Float64Histogram {
+	mp := tracker.ActiveMeterProvider()
+	if h, ok := durations.Load(mp); ok {
+		return h.(metric.Float64Histogram)
+	}
+	h, _ := mp.Meter(instrumentationName).Float64Histogram("db.client.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of Redis commands."))
+	actual, _ := durations.LoadOrStore(mp, h)
+	return actual.(metric.Float64Histogram)
+}
@@ -0,0 +1,256 @@
+package mwredis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestConfig() (*tracker.Config, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return &tracker.Config{Tp: tp}, exporter
+}
+
+func attributeValue(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	cfg, exporter := newTestConfig()
+	stop := Instrument(rdb, cfg)
+	defer stop()
+
+	ctx := context.Background()
+	if err := rdb.Set(ctx, "session:42", "secret", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.Get(ctx, "missing").Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("Get = %v, want redis.Nil", err)
+	}
+	pipe := rdb.Pipeline()
+	pipe.Incr(ctx, "counter")
+	pipe.HSet(ctx, "user:7", "email", "a@example.com")
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	tests := []struct {
+		name      string
+		statement string
+	}{
+		{"SET", "SET session:42 ?"},
+		{"GET", "GET missing"},
+		{"pipeline", "INCR counter\nHSET user:7 email ?"},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name != tt.name {
+			t.Errorf("span %d name = %q, want %q", i, span.Name, tt.name)
+		}
+		if got := attributeValue(span, "db.statement"); got != tt.statement {
+			t.Errorf("%s db.statement = %q, want %q", tt.name, got, tt.statement)
+		}
+		if got := attributeValue(span, "server.address"); got != mr.Host() {
+			t.Errorf("%s server.address = %q, want %q", tt.name, got, mr.Host())
+		}
+		if span.Status.Code != 0 {
+			t.Errorf("%s status = %v, want unset", tt.name, span.Status)
+		}
+	}
+}
+
+func TestRingServerAddress(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{"shard": mr.Addr()}})
+	defer rdb.Close()
+	cfg, exporter := newTestConfig()
+	stop := Instrument(rdb, cfg)
+	defer stop()
+
+	if err := rdb.Set(context.Background(), "k", "v", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if got := attributeValue(spans[0], "server.address"); got != mr.Host() {
+		t.Errorf("server.address = %q, want %q", got, mr.Host())
+	}
+	if got := attributeValue(spans[0], "server.port"); got != mr.Port() {
+		t.Errorf("server.port = %q, want %q", got, mr.Port())
+	}
+}
+
+func TestClusterServerAddress(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	defer rdb.Close()
+	cfg, exporter := newTestConfig()
+	stop := Instrument(rdb, cfg)
+	defer stop()
+
+	ctx := context.Background()
+	if err := rdb.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	pipe := rdb.Pipeline()
+	pipe.Get(ctx, "k")
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+		if got := attributeValue(span, "server.address"); got != mr.Host() {
+			t.Errorf("%s server.address = %q, want %q", span.Name, got, mr.Host())
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("got spans %q, want SET and pipeline", names)
+	}
+}
+
+func TestClusterNodesCreatedBeforeInstrument(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	defer rdb.Close()
+	ctx := context.Background()
+	// Using the client creates its nodes.
+	if err := rdb.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, exporter := newTestConfig()
+	stop := Instrument(rdb, cfg)
+	defer stop()
+	if err := rdb.Get(ctx, "k").Err(); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if got := attributeValue(spans[0], "server.address"); got != mr.Host() {
+		t.Errorf("server.address = %q, want %q", got, mr.Host())
+	}
+}
+
+func TestStatsInstruments(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	cfg, _ := newTestConfig()
+	stop := Instrument(rdb, cfg)
+	defer stop()
+	for i := 0; i < 2; i++ {
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	for _, name := range []string{"db.redis.connection.total", "db.redis.connection.idle"} {
+		if _, ok := metrics[name].(metricdata.Gauge[int64]); !ok {
+			t.Errorf("%s = %T, want a gauge", name, metrics[name])
+		}
+	}
+	for _, name := range []string{"db.redis.connection.stale", "db.redis.pool.hits", "db.redis.pool.misses", "db.redis.pool.timeouts"} {
+		if sum, ok := metrics[name].(metricdata.Sum[int64]); !ok || !sum.IsMonotonic {
+			t.Errorf("%s = %T, want a monotonic sum", name, metrics[name])
+		}
+	}
+	// The second Ping reused the connection of the first.
+	hits := metrics["db.redis.pool.hits"].(metricdata.Sum[int64])
+	if len(hits.DataPoints) != 1 || hits.DataPoints[0].Value < 1 {
+		t.Errorf("db.redis.pool.hits = %v, want at least one hit", hits.DataPoints)
+	}
+}
+
+func TestStatsStopWhenClientIsClosed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cfg, _ := newTestConfig()
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	Instrument(rdb, cfg)
+	if _, ok := statsClients.Load(rdb); !ok {
+		t.Fatal("client not reported")
+	}
+	rdb.Close()
+	if err := rdb.Ping(context.Background()).Err(); !errors.Is(err, redis.ErrClosed) {
+		t.Fatalf("Ping = %v, want redis.ErrClosed", err)
+	}
+	if _, ok := statsClients.Load(rdb); ok {
+		t.Error("closed client still reported")
+	}
+
+	rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	stop := Instrument(rdb, cfg)
+	stop()
+	if _, ok := statsClients.Load(rdb); ok {
+		t.Error("client still reported after stop")
+	}
+}
+
+func TestServerAttributes(t *testing.T) {
+	tests := []struct {
+		addr string
+		host string
+		port string
+	}{
+		{"localhost:6379", "localhost", "6379"},
+		{"[::1]:6380", "::1", "6380"},
+		{"/tmp/redis.sock", "/tmp/redis.sock", ""},
+	}
+	for _, tt := range tests {
+		values := map[string]string{}
+		for _, kv := range serverAttributes(&redis.Options{Addr: tt.addr, DB: 2}) {
+			values[string(kv.Key)] = kv.Value.Emit()
+		}
+		if values["server.address"] != tt.host || values["server.port"] != tt.port {
+			t.Errorf("serverAttributes(%q) = %v, want address %q and port %q", tt.addr, values, tt.host, tt.port)
+		}
+		if got := values["db.redis.database_index"]; got != strconv.Itoa(2) {
+			t.Errorf("db.redis.database_index = %q, want 2", got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package mwredis
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	statsClients   sync.Map // redis.UniversalClient -> attribute.Set
+	statsProviders sync.Map // metric.MeterProvider -> struct{}
+)
+
+// recordStats reports the pool statistics of rdb, from PoolStats, as
+// observable instruments on the tracker's meter provider: the current
+// connections as gauges and the totals as counters.
+func recordStats(rdb redis.UniversalClient, attributes attribute.Set) {
+	statsClients.Store(rdb, attributes)
+	registerStats()
+}
+
+// registerStats registers the statistics callback with the tracker's meter
+// provider. It is called again for each command, so that the callback is
+// registered once Track has initialised metrics in the background.
+func registerStats() {
+	mp := tracker.ActiveMeterProvider()
+	if _, loaded := statsProviders.LoadOrStore(mp, struct{}{}); loaded {
+		return
+	}
+
+	meter := mp.Meter(instrumentationName)
+	total, _ := meter.Int64ObservableGauge("db.redis.connection.total",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of connections in the pool."))
+	idle, _ := meter.Int64ObservableGauge("db.redis.connection.idle",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of idle connections in the pool."))
+	stale, _ := meter.Int64ObservableCounter("db.redis.connection.stale",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Total number of stale connections removed from the pool."))
+	hits, _ := meter.Int64ObservableCounter("db.redis.pool.hits",
+		metric.WithUnit("{hit}"),
+		metric.WithDescription("Total number of times a free connection was found in the pool."))
+	misses, _ := meter.Int64ObservableCounter("db.redis.pool.misses",
+		metric.WithUnit("{miss}"),
+		metric.WithDescription("Total number of times a free connection was not found in the pool."))
+	timeouts, _ := meter.Int64ObservableCounter("db.redis.pool.timeouts",
+		metric.WithUnit("{timeout}"),
+		metric.WithDescription("Total number of timeouts waiting for a connection."))
+
+	_, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		statsClients.Range(func(key, value any) bool {
+			stats := key.(redis.UniversalClient).PoolStats()
+			attributes := metric.WithAttributeSet(value.(attribute.Set))
+			o.ObserveInt64(total, int64(stats.TotalConns), attributes)
+			o.ObserveInt64(idle, int64(stats.IdleConns), attributes)
+			o.ObserveInt64(stale, int64(stats.StaleConns), attributes)
+			o.ObserveInt64(hits, int64(stats.Hits), attributes)
+			o.ObserveInt64(misses, int64(stats.Misses), attributes)
+			o.ObserveInt64(timeouts, int64(stats.Timeouts), attributes)
+			return true
+		})
+		return nil
+	}, total, idle, stale, hits, misses, timeouts)
+	if err != nil {
+		log.Println("failed to register redis pool stats callback: ", err)
+	}
+}
@@ -0,0 +1,407 @@
+package mwsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The wrappers implement every optional driver interface and fall back to
+// what database/sql would do when the wrapped driver does not.
+
+type wrappedDriver struct {
+	driver.Driver
+	c config
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{Conn: conn, c: d.c}, nil
+}
+
+func (d *wrappedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.Driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &wrappedConnector{Connector: connector, d: d}, nil
+	}
+	return &wrappedConnector{Connector: dsnConnector{name: name, d: d.Driver}, d: d}, nil
+}
+
+// dsnConnector is the connector of drivers that only implement Open.
+type dsnConnector struct {
+	name string
+	d    driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.d.Open(c.name)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.d
+}
+
+type wrappedConnector struct {
+	driver.Connector
+	d *wrappedDriver
+	// onClose is called when the database using the connector is closed.
+	onClose func()
+}
+
+func (c *wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{Conn: conn, c: c.d.c}, nil
+}
+
+func (c *wrappedConnector) Driver() driver.Driver {
+	return c.d
+}
+
+// Close is called by sql.DB.Close.
+func (c *wrappedConnector) Close() error {
+	if c.onClose != nil {
+		c.onClose()
+	}
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type wrappedConn struct {
+	driver.Conn
+	c config
+}
+
+// Unwrap returns the connection of the wrapped driver, for use with
+// sql.Conn.Raw.
+func (c *wrappedConn) Unwrap() driver.Conn {
+	return c.Conn
+}
+
+func (c *wrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+	var stmt driver.Stmt
+	var err error
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = pc.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+		if err == nil && ctx.Err() != nil {
+			stmt.Close()
+			stmt, err = nil, ctx.Err()
+		}
+	}
+	c.c.record(ctx, "sql.prepare", query, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return newWrappedStmt(stmt, c.Conn, query, c.c), nil
+}
+
+func (c *wrappedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var tx driver.Tx
+	var err error
+	if bt, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = bt.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(0) {
+		err = errors.New("mwsql: driver does not support non-default isolation level")
+	} else if opts.ReadOnly {
+		err = errors.New("mwsql: driver does not support read-only transactions")
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	c.c.record(ctx, "sql.begin", "", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedTx{Tx: tx, ctx: ctx, c: c.c}, nil
+}
+
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var result driver.Result
+	var err error
+	switch e := c.Conn.(type) {
+	case driver.ExecerContext:
+		result, err = e.ExecContext(ctx, query, args)
+	case driver.Execer:
+		var values []driver.Value
+		if values, err = namedValues(args); err != nil {
+			return nil, err
+		}
+		result, err = e.Exec(query, values)
+	default:
+		return nil, driver.ErrSkip
+	}
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	c.c.record(ctx, "", query, start, err)
+	return result, err
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	switch q := c.Conn.(type) {
+	case driver.QueryerContext:
+		rows, err = q.QueryContext(ctx, query, args)
+	case driver.Queryer:
+		var values []driver.Value
+		if values, err = namedValues(args); err != nil {
+			return nil, err
+		}
+		rows, err = q.Query(query, values)
+	default:
+		return nil, driver.ErrSkip
+	}
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	return c.c.recordRows(ctx, query, start, rows, err)
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type wrappedStmt struct {
+	driver.Stmt
+	conn  driver.Conn
+	query string
+	c     config
+}
+
+// wrappedColumnConverterStmt is a wrappedStmt of a statement implementing
+// driver.ColumnConverter. Other statements must not implement it, or
+// database/sql converts their arguments with driver.DefaultParameterConverter
+// rather than with the connection's driver.NamedValueChecker.
+type wrappedColumnConverterStmt struct {
+	*wrappedStmt
+}
+
+func (s wrappedColumnConverterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.Stmt.(driver.ColumnConverter).ColumnConverter(idx)
+}
+
+func newWrappedStmt(stmt driver.Stmt, conn driver.Conn, query string, c config) driver.Stmt {
+	s := &wrappedStmt{Stmt: stmt, conn: conn, query: query, c: c}
+	if _, ok := stmt.(driver.ColumnConverter); ok {
+		return wrappedColumnConverterStmt{s}
+	}
+	return s
+}
+
+func (s *wrappedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.Stmt.Exec(args)
+	s.c.record(context.Background(), "", s.query, start, err)
+	return result, err
+}
+
+func (s *wrappedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.Query(args)
+	return s.c.recordRows(context.Background(), s.query, start, rows, err)
+}
+
+func (s *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err != nil {
+			return nil, err
+		}
+		result, err = s.Stmt.Exec(values)
+	}
+	s.c.record(ctx, "", s.query, start, err)
+	return result, err
+}
+
+func (s *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err != nil {
+			return nil, err
+		}
+		rows, err = s.Stmt.Query(values)
+	}
+	return s.c.recordRows(ctx, s.query, start, rows, err)
+}
+
+// CheckNamedValue uses the checker of the statement or, like database/sql
+// does for unwrapped statements, of the connection.
+func (s *wrappedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	if n, ok := s.conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// wrappedRows ends the span of a query once its rows are closed, so that
+// the span covers reading them.
+type wrappedRows struct {
+	driver.Rows
+	span trace.Span
+	err  error
+}
+
+func (r *wrappedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+func (r *wrappedRows) Close() error {
+	err := r.Rows.Close()
+	if r.err == nil {
+		r.err = err
+	}
+	endSpan(r.span, r.err)
+	return err
+}
+
+func (r *wrappedRows) HasNextResultSet() bool {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *wrappedRows) NextResultSet() error {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *wrappedRows) ColumnTypeScanType(index int) reflect.Type {
+	if t, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return t.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *wrappedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if t, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return t.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *wrappedRows) ColumnTypeLength(index int) (int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return t.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *wrappedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return t.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *wrappedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return t.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+type wrappedTx struct {
+	driver.Tx
+	ctx context.Context
+	c   config
+}
+
+func (t *wrappedTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	t.c.record(t.ctx, "sql.commit", "", start, err)
+	return err
+}
+
+func (t *wrappedTx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	t.c.record(t.ctx, "sql.rollback", "", start, err)
+	return err
+}
+
+// namedValues converts args for drivers without context methods, which do
+// not support named parameters.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("mwsql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,187 @@
+// Package mwsql instruments database/sql drivers with the providers
+// configured by tracker.Track.
+package mwsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"github.com/middleware-labs/golang-apm/tracker/sanitize"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/middleware-labs/golang-apm/mwsql"
+
+type config struct {
+	system     string
+	dialect    *sanitize.Dialect
+	attributes []attribute.KeyValue
+}
+
+type Option interface {
+	apply(config) config
+}
+
+type optFunc func(config) config
+
+func (f optFunc) apply(c config) config { return f(c) }
+
+// WithSystem sets db.system, e.g. "postgresql". Open derives it from the
+// driver name; drivers wrapped with Wrap report "other_sql" without it.
+func WithSystem(system string) Option {
+	return optFunc(func(c config) config {
+		c.system = system
+		return c
+	})
+}
+
+// WithDialect sets the quoting rules used to sanitize statements. It is
+// derived from db.system for PostgreSQL, MySQL and ClickHouse.
+func WithDialect(dialect sanitize.Dialect) Option {
+	return optFunc(func(c config) config {
+		c.dialect = &dialect
+		return c
+	})
+}
+
+// WithAttributes adds attributes to every span and connection pool metric,
+// e.g. db.name.
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return optFunc(func(c config) config {
+		c.attributes = append(c.attributes, attributes...)
+		return c
+	})
+}
+
+func newConfig(options []Option) config {
+	c := config{system: "other_sql"}
+	for _, opt := range options {
+		c = opt.apply(c)
+	}
+	if c.dialect == nil {
+		dialect := dialects[c.system]
+		c.dialect = &dialect
+	}
+	return c
+}
+
+// baseAttributes returns db.system and the attributes given with
+// WithAttributes.
+func (c config) baseAttributes() []attribute.KeyValue {
+	return append([]attribute.KeyValue{attribute.String("db.system", c.system)}, c.attributes...)
+}
+
+// systems maps well-known driver names to db.system values.
+var systems = map[string]string{
+	"postgres":   "postgresql",
+	"postgresql": "postgresql",
+	"pgx":        "postgresql",
+	"mysql":      "mysql",
+	"sqlite":     "sqlite",
+	"sqlite3":    "sqlite",
+	"sqlserver":  "mssql",
+	"mssql":      "mssql",
+	"godror":     "oracle",
+	"oracle":     "oracle",
+	"clickhouse": "clickhouse",
+}
+
+// dialects maps db.system values to the quoting rules of their statements.
+var dialects = map[string]sanitize.Dialect{
+	"postgresql": sanitize.Postgres,
+	"mysql":      sanitize.MySQL,
+	"clickhouse": sanitize.MySQL,
+}
+
+// Open opens a database like sql.Open, with the driver registered as
+// driverName wrapped by Wrap. The connection pool of the returned database
+// is reported with RecordStats until it is closed.
+//
+//	db, err := mwsql.Open("postgres", dsn, mwsql.WithAttributes(attribute.String("db.name", "orders")))
+func Open(driverName, dsn string, opts ...Option) (*sql.DB, error) {
+	if system, ok := systems[driverName]; ok {
+		opts = append([]Option{WithSystem(system)}, opts...)
+	}
+
+	// sql.Open does not connect; it is only used to find the registered
+	// driver.
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+
+	connector, err := (&wrappedDriver{Driver: d, c: newConfig(opts)}).OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db = sql.OpenDB(connector)
+	// sql.DB.Close closes the connector, which stops reporting the pool.
+	connector.(*wrappedConnector).onClose = RecordStats(db, opts...)
+	return db, nil
+}
+
+// Wrap returns a driver creating spans for the queries, statements and
+// transactions of d. Use it with sql.Register or sql.OpenDB.
+func Wrap(d driver.Driver, opts ...Option) driver.Driver {
+	return &wrappedDriver{Driver: d, c: newConfig(opts)}
+}
+
+// record creates a span for a call to the driver that started at start. The
+// span is created afterwards so that calls the driver skips, answering
+// driver.ErrSkip, are not reported.
+func (c config) record(ctx context.Context, name, query string, start time.Time, err error) {
+	endSpan(c.startSpan(ctx, name, query, start), err)
+}
+
+// recordRows is record for queries. When the query succeeds, its span ends
+// once rows are closed.
+func (c config) recordRows(ctx context.Context, query string, start time.Time, rows driver.Rows, err error) (driver.Rows, error) {
+	span := c.startSpan(ctx, "", query, start)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &wrappedRows{Rows: rows, span: span}, nil
+}
+
+func (c config) startSpan(ctx context.Context, name, query string, start time.Time) trace.Span {
+	registerStats()
+
+	attributes := c.baseAttributes()
+	if query != "" {
+		if operation := sanitize.Operation(query); operation != "" {
+			attributes = append(attributes, attribute.String("db.operation", operation))
+			if name == "" {
+				name = operation
+			}
+		}
+		attributes = append(attributes, attribute.String("db.statement", sanitize.SQL(query, *c.dialect)))
+	}
+	if name == "" {
+		name = "sql.query"
+	}
+
+	_, span := tracker.ActiveTracerProvider().Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(attributes...),
+	)
+	return span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+	span.End()
+}
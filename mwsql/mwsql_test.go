@@ -0,0 +1,265 @@
+package mwsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/middleware-labs/golang-apm/tracker/sanitize"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// money is a type only the fake connection accepts as an argument.
+type money struct{ cents int64 }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{}, nil }
+
+// fakeConn converts money arguments itself, as drivers like pgx do.
+type fakeConn struct {
+	args []driver.NamedValue
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if m, ok := nv.Value.(money); ok {
+		nv.Value = m.cents
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+type fakeStmt struct {
+	conn *fakeConn
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	s.conn.args = args
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{n: 2}, nil
+}
+
+type fakeRows struct {
+	n int
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 0 {
+		return io.EOF
+	}
+	r.n--
+	dest[0] = int64(r.n)
+	return nil
+}
+
+func init() {
+	sql.Register("mwsql-fake", fakeDriver{})
+}
+
+func withTestTracerProvider(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestStatementUsesConnectionChecker(t *testing.T) {
+	withTestTracerProvider(t)
+	db, err := Open("mwsql-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stmt, err := db.Prepare("UPDATE accounts SET balance = $1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(money{cents: 1050}); err != nil {
+		t.Fatalf("Exec with a type the connection accepts: %v", err)
+	}
+
+	var conn *fakeConn
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Raw(func(dc any) error {
+		conn = dc.(*wrappedConn).Unwrap().(*fakeConn)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.args) != 1 || conn.args[0].Value != int64(1050) {
+		t.Errorf("args = %v, want the converted value 1050", conn.args)
+	}
+}
+
+func TestStatementWithoutColumnConverter(t *testing.T) {
+	s := newWrappedStmt(&fakeStmt{}, &fakeConn{}, "", config{})
+	if _, ok := s.(driver.ColumnConverter); ok {
+		t.Error("statement implements driver.ColumnConverter, want only when the driver's does")
+	}
+}
+
+func TestQuerySpanEndsWhenRowsAreClosed(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+	db, err := Open("mwsql-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stmt, err := db.Prepare("SELECT id FROM orders WHERE customer = 'alice'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	exporter.Reset()
+
+	rows, err := stmt.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatalf("no rows: %v", rows.Err())
+	}
+	if got := len(exporter.GetSpans()); got != 0 {
+		t.Fatalf("got %d spans while reading the rows, want 0", got)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	for _, kv := range spans[0].Attributes {
+		if kv.Key == "db.statement" {
+			if got, want := kv.Value.AsString(), "SELECT id FROM orders WHERE customer = ?"; got != want {
+				t.Errorf("db.statement = %q, want %q", got, want)
+			}
+		}
+	}
+}
+
+func TestStatsStopWhenDatabaseIsClosed(t *testing.T) {
+	db, err := Open("mwsql-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := statsDatabases.Load(db); !ok {
+		t.Fatal("database not reported")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := statsDatabases.Load(db); ok {
+		t.Error("closed database still reported")
+	}
+
+	connector, err := Wrap(fakeDriver{}).(driver.DriverContext).OpenConnector("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = sql.OpenDB(connector)
+	defer db.Close()
+	stop := RecordStats(db)
+	stop()
+	if _, ok := statsDatabases.Load(db); ok {
+		t.Error("database still reported after stop")
+	}
+}
+
+func TestStatsInstruments(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	connector, err := Wrap(fakeDriver{}).(driver.DriverContext).OpenConnector("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	stop := RecordStats(db)
+	defer stop()
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	for _, name := range []string{"db.sql.connection.open", "db.sql.connection.in_use", "db.sql.connection.idle"} {
+		if _, ok := metrics[name].(metricdata.Gauge[int64]); !ok {
+			t.Errorf("%s = %T, want a gauge", name, metrics[name])
+		}
+	}
+	if open := metrics["db.sql.connection.open"].(metricdata.Gauge[int64]); len(open.DataPoints) != 1 || open.DataPoints[0].Value != 1 {
+		t.Errorf("db.sql.connection.open = %v, want 1 connection", open.DataPoints)
+	}
+	// Wait statistics are totals, which only grow.
+	if sum, ok := metrics["db.sql.connection.wait_count"].(metricdata.Sum[int64]); !ok || !sum.IsMonotonic {
+		t.Errorf("db.sql.connection.wait_count = %T, want a monotonic sum", metrics["db.sql.connection.wait_count"])
+	}
+	if sum, ok := metrics["db.sql.connection.wait_duration"].(metricdata.Sum[float64]); !ok || !sum.IsMonotonic {
+		t.Errorf("db.sql.connection.wait_duration = %T, want a monotonic sum", metrics["db.sql.connection.wait_duration"])
+	}
+}
+
+func TestDialectFromSystem(t *testing.T) {
+	tests := map[string]sanitize.Dialect{
+		"postgresql": sanitize.Postgres,
+		"mysql":      sanitize.MySQL,
+		"clickhouse": sanitize.MySQL,
+		"other_sql":  sanitize.Generic,
+	}
+	for system, want := range tests {
+		if got := *newConfig([]Option{WithSystem(system)}).dialect; got != want {
+			t.Errorf("dialect of %s = %v, want %v", system, got, want)
+		}
+	}
+}
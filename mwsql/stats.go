@@ -0,0 +1,82 @@
+package mwsql
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+
+	"github.com/middleware-labs/golang-apm/tracker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	statsDatabases sync.Map // *sql.DB -> attribute.Set
+	statsProviders sync.Map // metric.MeterProvider -> struct{}
+)
+
+// RecordStats reports the connection pool statistics of db, from
+// sql.DB.Stats, as observable instruments on the tracker's meter provider,
+// until stop is called. Open calls it and stops when the database is closed;
+// use it for databases opened with a driver from Wrap and call stop when
+// closing them.
+//
+//	db := sql.OpenDB(connector)
+//	stop := mwsql.RecordStats(db)
+//	defer func() {
+//		stop()
+//		db.Close()
+//	}()
+func RecordStats(db *sql.DB, opts ...Option) (stop func()) {
+	c := newConfig(opts)
+	statsDatabases.Store(db, attribute.NewSet(c.baseAttributes()...))
+	registerStats()
+	return func() { statsDatabases.Delete(db) }
+}
+
+// registerStats registers the statistics callback with the tracker's meter
+// provider. It is called again for each query, so that the callback is
+// registered once Track has initialised metrics in the background.
+func registerStats() {
+	mp := tracker.ActiveMeterProvider()
+	if _, loaded := statsProviders.LoadOrStore(mp, struct{}{}); loaded {
+		return
+	}
+
+	meter := mp.Meter(instrumentationName)
+	open, _ := meter.Int64ObservableGauge("db.sql.connection.open",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of established connections, in use or idle."))
+	inUse, _ := meter.Int64ObservableGauge("db.sql.connection.in_use",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of connections in use."))
+	idle, _ := meter.Int64ObservableGauge("db.sql.connection.idle",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of idle connections."))
+	// The wait statistics are totals since the pool was opened, so they
+	// are reported as counters.
+	waitCount, _ := meter.Int64ObservableCounter("db.sql.connection.wait_count",
+		metric.WithUnit("{wait}"),
+		metric.WithDescription("Total number of connections waited for."))
+	waitDuration, _ := meter.Float64ObservableCounter("db.sql.connection.wait_duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Total time blocked waiting for a new connection."))
+
+	_, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		statsDatabases.Range(func(key, value any) bool {
+			stats := key.(*sql.DB).Stats()
+			attributes := metric.WithAttributeSet(value.(attribute.Set))
+			o.ObserveInt64(open, int64(stats.OpenConnections), attributes)
+			o.ObserveInt64(inUse, int64(stats.InUse), attributes)
+			o.ObserveInt64(idle, int64(stats.Idle), attributes)
+			o.ObserveInt64(waitCount, stats.WaitCount, attributes)
+			o.ObserveFloat64(waitDuration, stats.WaitDuration.Seconds(), attributes)
+			return true
+		})
+		return nil
+	}, open, inUse, idle, waitCount, waitDuration)
+	if err != nil {
+		log.Println("failed to register database stats callback: ", err)
+	}
+}
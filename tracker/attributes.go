@@ -0,0 +1,119 @@
+package tracker
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// redacted replaces the value of fields tagged with redact.
+const redacted = "[REDACTED]"
+
+// Attributes converts v, typically a struct or a pointer to one, into
+// attributes whose keys start with prefix. Exported fields are named after
+// their mw tag, or the snake_cased field name without one:
+//
+//	type Order struct {
+//		ID       string        `mw:"id"`
+//		Coupon   string        `mw:"coupon,omitempty"`
+//		CardNo   string        `mw:"card,redact"`
+//		Items    []Item        `mw:"items"`
+//		Internal string        `mw:"-"`
+//		Timeout  time.Duration // "timeout"
+//	}
+//
+//	span.SetAttributes(tracker.Attributes(order, "order")...)
+//
+// omitempty skips zero values and redact replaces the value with
+// "[REDACTED]". Nested structs and maps are flattened into dotted keys,
+// slices of scalars become array attributes and embedded structs without a
+// tag are inlined. Pointers and maps referring back to a value being
+// converted are skipped, and so are values nested more than ten levels deep.
+// The field metadata is computed once per type.
+func Attributes(v any, prefix string) []attribute.KeyValue {
+	return appendValueAttributes(nil, prefix, reflect.ValueOf(v))
+}
+
+// structField describes how a struct field is converted into an attribute.
+type structField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	redact    bool
+}
+
+var structFieldsCache sync.Map // reflect.Type -> []structField
+
+func cachedStructFields(t reflect.Type) []structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields, _ := structFieldsCache.LoadOrStore(t, structFields(t, nil, nil))
+	return fields.([]structField)
+}
+
+// structFields lists the fields of t, inlining embedded structs. embedding
+// holds the types whose fields are being inlined, so that a type embedding
+// itself, like struct{ *A }, is not expanded again.
+func structFields(t reflect.Type, index []int, embedding []reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("mw")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			if ft != t && !slices.Contains(embedding, ft) {
+				fields = append(fields, structFields(ft, fieldIndex, append(embedding, t))...)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		switch ft.Kind() {
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			continue
+		}
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		field := structField{index: fieldIndex, name: name}
+		for _, opt := range strings.Split(opts, ",") {
+			switch strings.TrimSpace(opt) {
+			case "omitempty":
+				field.omitEmpty = true
+			case "redact":
+				field.redact = true
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex reporting false instead of
+// panicking on a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
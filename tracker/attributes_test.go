@@ -0,0 +1,196 @@
+package tracker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type Audit struct {
+	CreatedBy string
+	Revision  int `mw:"rev"`
+}
+
+type Shipping struct {
+	City string `mw:"city"`
+}
+
+type lineItem struct {
+	SKU string `mw:"sku"`
+	Qty int    `mw:"qty"`
+}
+
+type order struct {
+	ID       string  `mw:"id"`
+	Coupon   string  `mw:"coupon,omitempty"`
+	Note     *string `mw:"note,omitempty"`
+	CardNo   string  `mw:"card,redact"`
+	Secret   string  `mw:",redact"`
+	Internal string  `mw:"-"`
+	Timeout  time.Duration
+	Items    []lineItem        `mw:"items"`
+	Labels   map[string]string `mw:"labels"`
+	Ship     Shipping          `mw:"ship"`
+	internal string
+	Callback func()
+	Audit
+	*Shipping
+}
+
+// node refers to itself through a pointer.
+type node struct {
+	Name string `mw:"name"`
+	Next *node  `mw:"next"`
+}
+
+// recursive embeds a pointer to its own type.
+type recursive struct {
+	*recursive
+	Name string `mw:"name"`
+}
+
+// outer and inner embed each other.
+type outer struct {
+	*inner
+	A int `mw:"a"`
+}
+
+type inner struct {
+	*outer
+	B int `mw:"b"`
+}
+
+// deep nests itself through a map, one level per value.
+type deep map[string]deep
+
+func TestAttributes(t *testing.T) {
+	loop := &node{Name: "a"}
+	loop.Next = &node{Name: "b", Next: loop}
+	self := map[string]any{"name": "root"}
+	self["self"] = self
+	nested := deep{}
+	for i := 0; i < 2*maxAttributeDepth; i++ {
+		nested = deep{"d": nested}
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  []attribute.KeyValue
+	}{
+		{
+			name: "tags",
+			value: order{
+				ID:       "o-1",
+				CardNo:   "4111",
+				Internal: "x",
+				internal: "y",
+				Timeout:  time.Second,
+				Audit:    Audit{CreatedBy: "ann", Revision: 2},
+				Callback: func() {},
+			},
+			want: []attribute.KeyValue{
+				attribute.String("o.id", "o-1"),
+				attribute.String("o.card", "[REDACTED]"),
+				attribute.String("o.secret", "[REDACTED]"),
+				attribute.String("o.timeout", "1s"),
+				attribute.StringSlice("o.items", []string{}),
+				attribute.String("o.ship.city", ""),
+				attribute.String("o.created_by", "ann"),
+				attribute.Int64("o.rev", 2),
+			},
+		},
+		{
+			name: "omitempty keeps set values",
+			value: &order{
+				Coupon: "SPRING",
+				Note:   new(string),
+				Items:  []lineItem{{"a", 1}, {"b", 2}},
+				Labels: map[string]string{"z": "1", "a": "2"},
+				Ship:   Shipping{City: "Oslo"},
+				// Embedded pointers are inlined when set.
+				Shipping: &Shipping{City: "Bergen"},
+			},
+			want: []attribute.KeyValue{
+				attribute.String("o.id", ""),
+				attribute.String("o.coupon", "SPRING"),
+				attribute.String("o.note", ""),
+				attribute.String("o.card", "[REDACTED]"),
+				attribute.String("o.secret", "[REDACTED]"),
+				attribute.String("o.timeout", "0s"),
+				attribute.String("o.items.0.sku", "a"),
+				attribute.Int64("o.items.0.qty", 1),
+				attribute.String("o.items.1.sku", "b"),
+				attribute.Int64("o.items.1.qty", 2),
+				attribute.String("o.labels.a", "2"),
+				attribute.String("o.labels.z", "1"),
+				attribute.String("o.ship.city", "Oslo"),
+				attribute.String("o.created_by", ""),
+				attribute.Int64("o.rev", 0),
+				attribute.String("o.city", "Bergen"),
+			},
+		},
+		{
+			name:  "map",
+			value: map[string]any{"b": []int{1}, "a": nil},
+			want:  []attribute.KeyValue{attribute.Int64Slice("o.b", []int64{1})},
+		},
+		{
+			name:  "pointer cycle",
+			value: loop,
+			want: []attribute.KeyValue{
+				attribute.String("o.name", "a"),
+				attribute.String("o.next.name", "b"),
+			},
+		},
+		{
+			name:  "map cycle",
+			value: self,
+			want:  []attribute.KeyValue{attribute.String("o.name", "root")},
+		},
+		{
+			name:  "self embedding",
+			value: recursive{recursive: &recursive{Name: "inner"}, Name: "outer"},
+			want:  []attribute.KeyValue{attribute.String("o.name", "outer")},
+		},
+		{
+			name:  "mutual embedding",
+			value: outer{inner: &inner{B: 2}, A: 1},
+			want:  []attribute.KeyValue{attribute.Int64("o.b", 2), attribute.Int64("o.a", 1)},
+		},
+		{
+			name:  "maximum depth",
+			value: nested,
+		},
+		{
+			name:  "scalar",
+			value: 3,
+			want:  []attribute.KeyValue{attribute.Int64("o", 3)},
+		},
+		{
+			name: "nil",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Attributes(tt.value, "o"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Attributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttributesSharedPointers(t *testing.T) {
+	// A value referenced twice but not from itself is converted both times.
+	shared := &Shipping{City: "Oslo"}
+	got := Attributes(struct {
+		From *Shipping `mw:"from"`
+		To   *Shipping `mw:"to"`
+	}{shared, shared}, "")
+	want := []attribute.KeyValue{attribute.String("from.city", "Oslo"), attribute.String("to.city", "Oslo")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Attributes() = %v, want %v", got, want)
+	}
+}
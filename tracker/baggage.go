@@ -0,0 +1,150 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// allBaggageKeys in the baggage allow-list copies every baggage member.
+const allBaggageKeys = "*"
+
+// SetBaggage returns a copy of ctx with the baggage member key set to value.
+// The key must be a valid W3C baggage key; the value may be any string and is
+// percent-encoded on the wire. ctx is returned unchanged with an error when
+// the member is invalid or the baggage would exceed its size limits.
+func SetBaggage(ctx context.Context, key, value string) (context.Context, error) {
+	if key == "" {
+		return ctx, errors.New("baggage key must not be empty")
+	}
+	member, err := baggage.NewMemberRaw(key, value)
+	if err != nil {
+		return ctx, err
+	}
+	b, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx, err
+	}
+	return baggage.ContextWithBaggage(ctx, b), nil
+}
+
+// Baggage returns the value of the baggage member key in ctx, or "" when it
+// is not set.
+func Baggage(ctx context.Context, key string) string {
+	return baggage.FromContext(ctx).Member(key).Value()
+}
+
+// baggageAttributes returns the allow-listed baggage members of ctx.
+func baggageAttributes(ctx context.Context, keys []string) []attribute.KeyValue {
+	b := baggage.FromContext(ctx)
+	if b.Len() == 0 {
+		return nil
+	}
+	var attributes []attribute.KeyValue
+	for _, key := range keys {
+		if key == allBaggageKeys {
+			attributes = attributes[:0]
+			for _, m := range b.Members() {
+				attributes = append(attributes, attribute.String(m.Key(), m.Value()))
+			}
+			return attributes
+		}
+		if m := b.Member(key); m.Key() != "" {
+			attributes = append(attributes, attribute.String(key, m.Value()))
+		}
+	}
+	return attributes
+}
+
+// BaggageSpanProcessor copies an allow-list of baggage members onto every
+// span when it starts, e.g. tenant.id or user.tier set at the edge of the
+// system. A key of "*" copies all members.
+type BaggageSpanProcessor struct {
+	keys []string
+}
+
+var _ sdktrace.SpanProcessor = (*BaggageSpanProcessor)(nil)
+
+// NewBaggageSpanProcessor returns a span processor for the given baggage keys.
+func NewBaggageSpanProcessor(keys ...string) *BaggageSpanProcessor {
+	return &BaggageSpanProcessor{keys: keys}
+}
+
+func (p *BaggageSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	s.SetAttributes(baggageAttributes(ctx, p.keys)...)
+}
+
+func (p *BaggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (p *BaggageSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *BaggageSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// BaggageLogProcessor copies an allow-list of baggage members onto every log
+// record emitted with a context carrying them. It must be registered before
+// the exporting processors.
+type BaggageLogProcessor struct {
+	keys []string
+}
+
+var _ sdklog.Processor = (*BaggageLogProcessor)(nil)
+
+// NewBaggageLogProcessor returns a log processor for the given baggage keys.
+func NewBaggageLogProcessor(keys ...string) *BaggageLogProcessor {
+	return &BaggageLogProcessor{keys: keys}
+}
+
+func (p *BaggageLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	for _, kv := range baggageAttributes(ctx, p.keys) {
+		r.AddAttributes(otellog.String(string(kv.Key), kv.Value.AsString()))
+	}
+	return nil
+}
+
+func (p *BaggageLogProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *BaggageLogProcessor) ForceFlush(context.Context) error { return nil }
+
+// baggageKeysFromSetting accepts the baggageAttributes setting as a []string
+// or, as decoded from JSON, a []interface{} of strings. Other values are
+// logged and ignored.
+func baggageKeysFromSetting(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		keys := make([]string, 0, len(v))
+		for _, key := range v {
+			s, ok := key.(string)
+			if !ok {
+				log.Printf("ignoring baggage attribute %v: not a string", key)
+				continue
+			}
+			keys = append(keys, s)
+		}
+		return keys
+	default:
+		log.Printf("ignoring baggageAttributes setting of type %T", v)
+		return nil
+	}
+}
+
+// baggageKeysFromEnv reads MW_BAGGAGE_ATTRIBUTES, a comma separated list of
+// baggage keys.
+func baggageKeysFromEnv() []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("MW_BAGGAGE_ATTRIBUTES"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,116 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBaggageKeysFromSetting(t *testing.T) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"baggageAttributes": ["tenant.id", "user.tier", 3]}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{"strings", []string{"tenant.id"}, []string{"tenant.id"}},
+		{"json", decoded["baggageAttributes"], []string{"tenant.id", "user.tier"}},
+		{"other", "tenant.id", nil},
+	}
+	for _, tt := range tests {
+		if got := baggageKeysFromSetting(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: baggageKeysFromSetting() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// baggageContext returns a context carrying the tenant.id, user.tier and
+// session baggage members.
+func baggageContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	for _, kv := range [][2]string{{"tenant.id", "acme"}, {"user.tier", "gold plan"}, {"session", "s3cr3t"}} {
+		var err error
+		if ctx, err = SetBaggage(ctx, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ctx
+}
+
+var baggageProcessorTests = []struct {
+	name string
+	keys []string
+	want map[string]string
+}{
+	{"selected keys", []string{"tenant.id", "user.tier"}, map[string]string{"tenant.id": "acme", "user.tier": "gold plan"}},
+	{"missing key", []string{"tenant.id", "region"}, map[string]string{"tenant.id": "acme"}},
+	{"all keys", []string{"*"}, map[string]string{"tenant.id": "acme", "user.tier": "gold plan", "session": "s3cr3t"}},
+	{"all keys after a selected key", []string{"tenant.id", "*"}, map[string]string{"tenant.id": "acme", "user.tier": "gold plan", "session": "s3cr3t"}},
+	{"no keys", nil, map[string]string{}},
+}
+
+func TestBaggageSpanProcessor(t *testing.T) {
+	ctx := baggageContext(t)
+	for _, tt := range baggageProcessorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSpanProcessor(NewBaggageSpanProcessor(tt.keys...)),
+				sdktrace.WithSyncer(exporter),
+			)
+			_, span := tp.Tracer("test").Start(ctx, "checkout")
+			span.End()
+
+			got := map[string]string{}
+			for _, kv := range exporter.GetSpans()[0].Attributes {
+				got[string(kv.Key)] = kv.Value.AsString()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("span attributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaggageLogProcessor(t *testing.T) {
+	ctx := baggageContext(t)
+	for _, tt := range baggageProcessorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, recorder := newLogRecorder(NewBaggageLogProcessor(tt.keys...))
+			var record otellog.Record
+			record.SetBody(otellog.StringValue("order placed"))
+			lp.Logger("test").Emit(ctx, record)
+
+			got := map[string]string{}
+			records := recorder.Records()
+			for key, value := range recordAttributes(records[0].WalkAttributes) {
+				got[key] = value.AsString()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("log attributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetBaggage(t *testing.T) {
+	ctx := baggageContext(t)
+	if got := Baggage(ctx, "user.tier"); got != "gold plan" {
+		t.Errorf("Baggage(user.tier) = %q, want %q", got, "gold plan")
+	}
+	if got := Baggage(ctx, "region"); got != "" {
+		t.Errorf("Baggage(region) = %q, want empty", got)
+	}
+	if got, err := SetBaggage(ctx, "", "v"); err == nil || got != ctx {
+		t.Errorf("SetBaggage with an empty key = %v, want the context unchanged and an error", err)
+	}
+}
@@ -0,0 +1,371 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultAWSMetadataURL = "http://169.254.169.254"
+	defaultGCPMetadataURL = "http://metadata.google.internal"
+
+	// Metadata servers answer within a few milliseconds when they exist. Off
+	// cloud the request has to time out, so keep the startup cost small.
+	cloudMetadataTimeout = 300 * time.Millisecond
+)
+
+// cloudDetector figures out which cloud platform the process runs on. The
+// metadata base URLs can be pointed at a local stub via MW_AWS_METADATA_URL,
+// MW_GCP_METADATA_URL (or GCE_METADATA_HOST).
+type cloudDetector struct {
+	root           string
+	getenv         func(string) string
+	client         *http.Client
+	awsMetadataURL string
+	gcpMetadataURL string
+}
+
+// newCloudDetector returns a detector reading DMI files under root (normally
+// "/") and the environment through getenv.
+func newCloudDetector(root string, getenv func(string) string) *cloudDetector {
+	if root == "" {
+		root = "/"
+	}
+	d := &cloudDetector{
+		root:           root,
+		getenv:         getenv,
+		client:         &http.Client{Timeout: cloudMetadataTimeout},
+		awsMetadataURL: defaultAWSMetadataURL,
+		gcpMetadataURL: defaultGCPMetadataURL,
+	}
+	if v := getenv("MW_AWS_METADATA_URL"); v != "" {
+		d.awsMetadataURL = strings.TrimSuffix(v, "/")
+	}
+	if v := getenv("GCE_METADATA_HOST"); v != "" {
+		d.gcpMetadataURL = "http://" + v
+	}
+	if v := getenv("MW_GCP_METADATA_URL"); v != "" {
+		d.gcpMetadataURL = strings.TrimSuffix(v, "/")
+	}
+	return d
+}
+
+// detect returns cloud.* and faas.* resource attributes, or nil when no
+// known platform was found. Platforms that can be recognised from the
+// environment are checked first; metadata endpoints are only probed when
+// nothing else matched and the DMI tables point at the vendor. ctx bounds
+// the time spent on metadata requests.
+func (d *cloudDetector) detect(ctx context.Context) []attribute.KeyValue {
+	detectors := []func(context.Context) []attribute.KeyValue{
+		d.detectLambda,
+		d.detectAzureFunctions,
+		d.detectAzureAppService,
+		d.detectCloudRun,
+		d.detectECS,
+		d.detectGKE,
+		d.detectEC2,
+	}
+	for _, detect := range detectors {
+		if attributes := detect(ctx); len(attributes) > 0 {
+			return attributes
+		}
+	}
+	return nil
+}
+
+func (d *cloudDetector) detectLambda(context.Context) []attribute.KeyValue {
+	name := d.getenv("AWS_LAMBDA_FUNCTION_NAME")
+	if name == "" {
+		return nil
+	}
+	a := cloudAttributes{}
+	a.string("cloud.provider", "aws")
+	a.string("cloud.platform", "aws_lambda")
+	a.string("cloud.region", d.getenv("AWS_REGION"))
+	a.string("faas.name", name)
+	a.string("faas.version", d.getenv("AWS_LAMBDA_FUNCTION_VERSION"))
+	a.string("faas.instance", d.getenv("AWS_LAMBDA_LOG_STREAM_NAME"))
+	a.megabytes("faas.max_memory", d.getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE"))
+	return a
+}
+
+func (d *cloudDetector) detectAzureFunctions(context.Context) []attribute.KeyValue {
+	if d.getenv("FUNCTIONS_WORKER_RUNTIME") == "" && d.getenv("FUNCTIONS_EXTENSION_VERSION") == "" {
+		return nil
+	}
+	name := d.getenv("WEBSITE_SITE_NAME")
+	a := cloudAttributes{}
+	a.string("cloud.provider", "azure")
+	a.string("cloud.platform", "azure_functions")
+	a.string("cloud.region", d.getenv("REGION_NAME"))
+	a.string("cloud.account.id", d.azureSubscription())
+	a.string("cloud.resource_id", d.azureResourceID(name))
+	a.string("faas.name", name)
+	a.string("faas.instance", d.getenv("WEBSITE_INSTANCE_ID"))
+	a.megabytes("faas.max_memory", d.getenv("WEBSITE_MEMORY_LIMIT_MB"))
+	return a
+}
+
+func (d *cloudDetector) detectAzureAppService(context.Context) []attribute.KeyValue {
+	name := d.getenv("WEBSITE_SITE_NAME")
+	if name == "" {
+		return nil
+	}
+	a := cloudAttributes{}
+	a.string("cloud.provider", "azure")
+	a.string("cloud.platform", "azure_app_service")
+	a.string("cloud.region", d.getenv("REGION_NAME"))
+	a.string("cloud.account.id", d.azureSubscription())
+	a.string("cloud.resource_id", d.azureResourceID(name))
+	a.string("host.id", d.getenv("WEBSITE_HOSTNAME"))
+	a.string("service.instance.id", d.getenv("WEBSITE_INSTANCE_ID"))
+	return a
+}
+
+// azureSubscription extracts the subscription ID from WEBSITE_OWNER_NAME,
+// which looks like "<subscription>+<resource group>-<region>webspace".
+func (d *cloudDetector) azureSubscription() string {
+	owner := d.getenv("WEBSITE_OWNER_NAME")
+	subscription, _, _ := strings.Cut(owner, "+")
+	return subscription
+}
+
+func (d *cloudDetector) azureResourceID(name string) string {
+	subscription := d.azureSubscription()
+	group := d.getenv("WEBSITE_RESOURCE_GROUP")
+	if subscription == "" || group == "" || name == "" {
+		return ""
+	}
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Web/sites/%s", subscription, group, name)
+}
+
+func (d *cloudDetector) detectCloudRun(ctx context.Context) []attribute.KeyValue {
+	service := d.getenv("K_SERVICE")
+	job := d.getenv("CLOUD_RUN_JOB")
+	if (service == "" || d.getenv("K_CONFIGURATION") == "") && job == "" {
+		return nil
+	}
+	// Knative sets the same variables on any cluster.
+	if !d.onGCE() {
+		return nil
+	}
+	a := cloudAttributes{}
+	a.string("cloud.provider", "gcp")
+	a.string("cloud.platform", "gcp_cloud_run")
+	if job != "" {
+		a.string("faas.name", job)
+		a.string("faas.version", d.getenv("CLOUD_RUN_EXECUTION"))
+	} else {
+		a.string("faas.name", service)
+		a.string("faas.version", d.getenv("K_REVISION"))
+	}
+	a.string("cloud.account.id", d.gcpMetadata(ctx, "project/project-id"))
+	a.string("cloud.region", lastPathSegment(d.gcpMetadata(ctx, "instance/region")))
+	a.string("faas.instance", d.gcpMetadata(ctx, "instance/id"))
+	return a
+}
+
+func (d *cloudDetector) detectGKE(ctx context.Context) []attribute.KeyValue {
+	if d.getenv("KUBERNETES_SERVICE_HOST") == "" || !d.onGCE() {
+		return nil
+	}
+	project := d.gcpMetadata(ctx, "project/project-id")
+	if project == "" {
+		return nil
+	}
+	a := cloudAttributes{}
+	a.string("cloud.provider", "gcp")
+	a.string("cloud.platform", "gcp_kubernetes_engine")
+	a.string("cloud.account.id", project)
+	a.string("k8s.cluster.name", d.gcpMetadata(ctx, "instance/attributes/cluster-name"))
+	// Zonal clusters report a zone ("us-central1-a"), regional ones a region.
+	location := d.gcpMetadata(ctx, "instance/attributes/cluster-location")
+	if strings.Count(location, "-") >= 2 {
+		a.string("cloud.availability_zone", location)
+		a.string("cloud.region", location[:strings.LastIndex(location, "-")])
+	} else {
+		a.string("cloud.region", location)
+	}
+	a.string("host.id", d.gcpMetadata(ctx, "instance/id"))
+	return a
+}
+
+// ecsTaskMetadata is the subset of the ECS task metadata v4 response used.
+type ecsTaskMetadata struct {
+	Cluster          string `json:"Cluster"`
+	TaskARN          string `json:"TaskARN"`
+	Family           string `json:"Family"`
+	Revision         string `json:"Revision"`
+	AvailabilityZone string `json:"AvailabilityZone"`
+	LaunchType       string `json:"LaunchType"`
+}
+
+func (d *cloudDetector) detectECS(ctx context.Context) []attribute.KeyValue {
+	endpoint := d.getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if endpoint == "" {
+		endpoint = d.getenv("ECS_CONTAINER_METADATA_URI")
+	}
+	if endpoint == "" {
+		return nil
+	}
+	a := cloudAttributes{}
+	a.string("cloud.provider", "aws")
+	a.string("cloud.platform", "aws_ecs")
+
+	region := d.getenv("AWS_REGION")
+	var task ecsTaskMetadata
+	body, err := d.get(ctx, strings.TrimSuffix(endpoint, "/")+"/task", nil)
+	if err == nil && json.Unmarshal(body, &task) == nil {
+		// arn:aws:ecs:<region>:<account>:task/<cluster>/<id>
+		if parts := strings.Split(task.TaskARN, ":"); len(parts) >= 6 {
+			region = parts[3]
+			a.string("cloud.account.id", parts[4])
+		}
+		a.string("cloud.availability_zone", task.AvailabilityZone)
+		a.string("aws.ecs.cluster.arn", task.Cluster)
+		a.string("aws.ecs.task.arn", task.TaskARN)
+		a.string("aws.ecs.task.family", task.Family)
+		a.string("aws.ecs.task.revision", task.Revision)
+		a.string("aws.ecs.launchtype", strings.ToLower(task.LaunchType))
+	}
+	a.string("cloud.region", region)
+	return a
+}
+
+// ec2IdentityDocument is the subset of the EC2 instance identity document used.
+type ec2IdentityDocument struct {
+	AccountID        string `json:"accountId"`
+	AvailabilityZone string `json:"availabilityZone"`
+	Region           string `json:"region"`
+	InstanceID       string `json:"instanceId"`
+	InstanceType     string `json:"instanceType"`
+	ImageID          string `json:"imageId"`
+}
+
+func (d *cloudDetector) detectEC2(ctx context.Context) []attribute.KeyValue {
+	if !d.onEC2() {
+		return nil
+	}
+	// IMDSv2 requires a session token; fall back to IMDSv1 if that fails.
+	headers := map[string]string{}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, d.awsMetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	if token, err := d.do(req); err == nil {
+		headers["X-aws-ec2-metadata-token"] = string(token)
+	}
+
+	body, err := d.get(ctx, d.awsMetadataURL+"/latest/dynamic/instance-identity/document", headers)
+	if err != nil {
+		return nil
+	}
+	var doc ec2IdentityDocument
+	if err := json.Unmarshal(body, &doc); err != nil || doc.InstanceID == "" {
+		return nil
+	}
+	a := cloudAttributes{}
+	a.string("cloud.provider", "aws")
+	a.string("cloud.platform", "aws_ec2")
+	a.string("cloud.region", doc.Region)
+	a.string("cloud.availability_zone", doc.AvailabilityZone)
+	a.string("cloud.account.id", doc.AccountID)
+	a.string("host.id", doc.InstanceID)
+	a.string("host.type", doc.InstanceType)
+	a.string("host.image.id", doc.ImageID)
+	return a
+}
+
+// onEC2 reports whether the DMI tables name AWS as the vendor, so that the
+// instance metadata service is not probed, and left to time out, elsewhere.
+// A metadata URL set through the environment is always probed.
+func (d *cloudDetector) onEC2() bool {
+	if d.getenv("MW_AWS_METADATA_URL") != "" {
+		return true
+	}
+	return strings.Contains(d.dmi("sys_vendor"), "Amazon") ||
+		strings.HasPrefix(strings.ToLower(d.dmi("product_uuid")), "ec2") ||
+		strings.HasPrefix(strings.ToLower(readFileTrimmed(filepath.Join(d.root, "sys", "hypervisor", "uuid"))), "ec2")
+}
+
+// onGCE reports whether the DMI tables name Google as the vendor, or a
+// metadata host was set through the environment.
+func (d *cloudDetector) onGCE() bool {
+	if d.getenv("MW_GCP_METADATA_URL") != "" || d.getenv("GCE_METADATA_HOST") != "" {
+		return true
+	}
+	return strings.Contains(d.dmi("sys_vendor"), "Google") ||
+		strings.Contains(d.dmi("product_name"), "Google")
+}
+
+func (d *cloudDetector) dmi(name string) string {
+	return readFileTrimmed(filepath.Join(d.root, "sys", "class", "dmi", "id", name))
+}
+
+// gcpMetadata reads a value from the GCP metadata server, returning "" when
+// it is unavailable.
+func (d *cloudDetector) gcpMetadata(ctx context.Context, path string) string {
+	body, err := d.get(ctx, d.gcpMetadataURL+"/computeMetadata/v1/"+path, map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func (d *cloudDetector) get(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return d.do(req)
+}
+
+func (d *cloudDetector) do(req *http.Request) ([]byte, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata request to %s returned %s", req.URL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// cloudAttributes collects attributes, skipping empty values.
+type cloudAttributes []attribute.KeyValue
+
+func (a *cloudAttributes) string(key, value string) {
+	if value != "" {
+		*a = append(*a, attribute.String(key, value))
+	}
+}
+
+// megabytes records a memory limit given in MiB as bytes, as the faas.*
+// semantic conventions expect.
+func (a *cloudAttributes) megabytes(key, value string) {
+	if mb, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*a = append(*a, attribute.Int64(key, mb*1024*1024))
+	}
+}
+
+func lastPathSegment(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+func addCloudAttributes(attributes []attribute.KeyValue, c *Config) []attribute.KeyValue {
+	return append(attributes, c.cloud...)
+}
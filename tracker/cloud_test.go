@@ -0,0 +1,216 @@
+package tracker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestCloudDetectorEC2(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("token"))
+		case r.URL.Path == "/latest/dynamic/instance-identity/document":
+			if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"accountId":"123456789012","availabilityZone":"eu-west-1b","region":"eu-west-1",` +
+				`"instanceId":"i-0abc","instanceType":"t3.small","imageId":"ami-0def"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer stub.Close()
+
+	env := map[string]string{"MW_AWS_METADATA_URL": stub.URL}
+	got := attributeMap(newCloudDetector(t.TempDir(), mapGetenv(env)).detect(context.Background()))
+	want := map[string]string{
+		"cloud.provider":          "aws",
+		"cloud.platform":          "aws_ec2",
+		"cloud.region":            "eu-west-1",
+		"cloud.availability_zone": "eu-west-1b",
+		"cloud.account.id":        "123456789012",
+		"host.id":                 "i-0abc",
+		"host.type":               "t3.small",
+		"host.image.id":           "ami-0def",
+	}
+	assertAttributes(t, got, want)
+}
+
+func TestCloudDetectorGKE(t *testing.T) {
+	values := map[string]string{
+		"project/project-id":                   "shop-prod",
+		"instance/id":                          "4242",
+		"instance/attributes/cluster-name":     "main",
+		"instance/attributes/cluster-location": "europe-west1-c",
+	}
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, ok := values[r.URL.Path[len("/computeMetadata/v1/"):]]
+		if r.Header.Get("Metadata-Flavor") != "Google" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(v))
+	}))
+	defer stub.Close()
+
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"MW_GCP_METADATA_URL":     stub.URL,
+	}
+	got := attributeMap(newCloudDetector(t.TempDir(), mapGetenv(env)).detect(context.Background()))
+	want := map[string]string{
+		"cloud.provider":          "gcp",
+		"cloud.platform":          "gcp_kubernetes_engine",
+		"cloud.account.id":        "shop-prod",
+		"cloud.region":            "europe-west1",
+		"cloud.availability_zone": "europe-west1-c",
+		"k8s.cluster.name":        "main",
+		"host.id":                 "4242",
+	}
+	assertAttributes(t, got, want)
+}
+
+func TestCloudDetectorLambda(t *testing.T) {
+	env := map[string]string{
+		"AWS_LAMBDA_FUNCTION_NAME":        "resize",
+		"AWS_LAMBDA_FUNCTION_VERSION":     "$LATEST",
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE": "128",
+		"AWS_REGION":                      "us-east-1",
+	}
+	got := newCloudDetector(t.TempDir(), mapGetenv(env)).detect(context.Background())
+	want := []attribute.KeyValue{
+		attribute.String("cloud.provider", "aws"),
+		attribute.String("cloud.platform", "aws_lambda"),
+		attribute.String("cloud.region", "us-east-1"),
+		attribute.String("faas.name", "resize"),
+		attribute.String("faas.version", "$LATEST"),
+		attribute.Int64("faas.max_memory", 128*1024*1024),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("detect() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("detect()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCloudDetectorCloudRun(t *testing.T) {
+	values := map[string]string{
+		"project/project-id": "shop-prod",
+		"instance/region":    "projects/123/regions/europe-west1",
+		"instance/id":        "00bf4b",
+	}
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, ok := values[r.URL.Path[len("/computeMetadata/v1/"):]]
+		if r.Header.Get("Metadata-Flavor") != "Google" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(v))
+	}))
+	defer stub.Close()
+
+	env := map[string]string{
+		"MW_GCP_METADATA_URL": stub.URL,
+		"K_SERVICE":           "checkout",
+		"K_CONFIGURATION":     "checkout",
+		"K_REVISION":          "checkout-00042",
+	}
+	got := attributeMap(newCloudDetector(t.TempDir(), mapGetenv(env)).detect(context.Background()))
+	want := map[string]string{
+		"cloud.provider":   "gcp",
+		"cloud.platform":   "gcp_cloud_run",
+		"cloud.account.id": "shop-prod",
+		"cloud.region":     "europe-west1",
+		"faas.name":        "checkout",
+		"faas.version":     "checkout-00042",
+		"faas.instance":    "00bf4b",
+	}
+	assertAttributes(t, got, want)
+}
+
+// Off cloud, with no DMI hint, no metadata endpoint must be contacted.
+func TestCloudDetectorSkipsMetadataWithoutHint(t *testing.T) {
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		// Knative services outside of GCP look like Cloud Run services.
+		"K_SERVICE":       "checkout",
+		"K_CONFIGURATION": "checkout",
+	}
+	d := newCloudDetector(t.TempDir(), mapGetenv(env))
+	d.client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected metadata request to %s", r.URL)
+		return nil, http.ErrHandlerTimeout
+	})
+	if got := d.detect(context.Background()); got != nil {
+		t.Errorf("detect() = %v, want nil", got)
+	}
+}
+
+func TestCloudDetectorDMIHint(t *testing.T) {
+	tests := []struct {
+		file, content string
+		ec2, gce      bool
+	}{
+		{file: "sys/class/dmi/id/sys_vendor", content: "Amazon EC2\n", ec2: true},
+		{file: "sys/class/dmi/id/product_uuid", content: "EC2E1916-9099-7CAF-FD21-012345ABCDEF\n", ec2: true},
+		{file: "sys/hypervisor/uuid", content: "ec2e1916-9099-7caf-fd21-012345abcdef\n", ec2: true},
+		{file: "sys/class/dmi/id/product_name", content: "Google Compute Engine\n", gce: true},
+		{file: "sys/class/dmi/id/sys_vendor", content: "QEMU\n"},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		path := filepath.Join(root, tt.file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		d := newCloudDetector(root, mapGetenv(nil))
+		if got := d.onEC2(); got != tt.ec2 {
+			t.Errorf("%s %q: onEC2() = %v, want %v", tt.file, tt.content, got, tt.ec2)
+		}
+		if got := d.onGCE(); got != tt.gce {
+			t.Errorf("%s %q: onGCE() = %v, want %v", tt.file, tt.content, got, tt.gce)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func mapGetenv(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func attributeMap(attributes []attribute.KeyValue) map[string]string {
+	m := make(map[string]string, len(attributes))
+	for _, kv := range attributes {
+		m[string(kv.Key)] = kv.Value.Emit()
+	}
+	return m
+}
+
+func assertAttributes(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("got %d attributes %v, want %d", len(got), got, len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package tracker
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// codeLocation is the resolved source location of a program counter.
+type codeLocation struct {
+	// spanName is the function qualified by its package name, e.g.
+	// "orders.(*Service).Create".
+	spanName   string
+	attributes []attribute.KeyValue
+}
+
+var codeLocations sync.Map // uintptr -> *codeLocation
+
+// callerPC returns the program counter of the function skip frames above
+// the caller of callerPC.
+func callerPC(skip int) uintptr {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return 0
+	}
+	return pcs[0]
+}
+
+// lookupCodeLocation resolves pc, caching the result since a call site
+// always resolves to the same location.
+func lookupCodeLocation(pc uintptr) *codeLocation {
+	if loc, ok := codeLocations.Load(pc); ok {
+		return loc.(*codeLocation)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	namespace, function := splitFunctionName(frame.Function)
+	spanName := frame.Function
+	if i := strings.LastIndexByte(spanName, '/'); i >= 0 {
+		spanName = spanName[i+1:]
+	}
+	loc := &codeLocation{
+		spanName: spanName,
+		attributes: []attribute.KeyValue{
+			attribute.String("code.function", function),
+			attribute.String("code.namespace", namespace),
+			attribute.String("code.filepath", frame.File),
+			attribute.Int("code.lineno", frame.Line),
+		},
+	}
+	actual, _ := codeLocations.LoadOrStore(pc, loc)
+	return actual.(*codeLocation)
+}
+
+// splitFunctionName splits a runtime function name such as
+// "github.com/acme/orders.(*Service).Create" into its namespace
+// ("github.com/acme/orders.(*Service)") and function ("Create").
+func splitFunctionName(name string) (namespace, function string) {
+	slash := strings.LastIndexByte(name, '/')
+	if i := strings.LastIndexByte(name[slash+1:], '.'); i >= 0 {
+		i += slash + 1
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// startSpan starts a span for the tracker helpers, adding the code location
+// of the caller skip frames above startSpan when enabled with the
+// CodeLocation config tag.
+func startSpan(ctx context.Context, name string, skip int, opts []trace.SpanStartOption) (context.Context, trace.Span) {
+	if c := activeConfig.Load(); c != nil && c.codeLocation {
+		if pc := callerPC(skip + 1); pc != 0 {
+			opts = append(opts, trace.WithAttributes(lookupCodeLocation(pc).attributes...))
+		}
+	}
+	return tracer().Start(ctx, name, opts...)
+}
+
+// Func starts a span named after the calling function, e.g.
+// "orders.(*Service).Create", with the code location of the call. The caller
+// must End the returned span:
+//
+//	func (s *Service) Create(ctx context.Context, o Order) error {
+//		ctx, span := tracker.Func(ctx)
+//		defer span.End()
+//		...
+//	}
+func Func(ctx context.Context, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	pc := callerPC(1)
+	if pc == 0 {
+		return tracer().Start(ctx, "unknown", opts...)
+	}
+	loc := lookupCodeLocation(pc)
+	opts = append(opts, trace.WithAttributes(loc.attributes...))
+	return tracer().Start(ctx, loc.spanName, opts...)
+}
@@ -0,0 +1,89 @@
+package tracker
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// callSite returns the file of the caller and the line after the call.
+func callSite() (string, int) {
+	_, file, line, _ := runtime.Caller(1)
+	return file, line + 1
+}
+
+func assertCodeLocation(t *testing.T, span tracetest.SpanStub, function, file string, line int) {
+	t.Helper()
+	attrs := attributeMap(span.Attributes)
+	if attrs["code.function"] != function {
+		t.Errorf("code.function = %q, want %q", attrs["code.function"], function)
+	}
+	if attrs["code.namespace"] != "github.com/middleware-labs/golang-apm/tracker" {
+		t.Errorf("code.namespace = %q, want the tracker package", attrs["code.namespace"])
+	}
+	if attrs["code.filepath"] != file {
+		t.Errorf("code.filepath = %q, want %q", attrs["code.filepath"], file)
+	}
+	if attrs["code.lineno"] != strconv.Itoa(line) {
+		t.Errorf("code.lineno = %s, want %d", attrs["code.lineno"], line)
+	}
+}
+
+func TestCodeLocation(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{codeLocation: true})
+
+	file, line := callSite()
+	_, span := StartSpan(context.Background(), "direct")
+	span.End()
+	assertCodeLocation(t, exporter.GetSpans()[0], "TestCodeLocation", file, line)
+
+	exporter.Reset()
+	file, line = callSite()
+	_ = Trace(context.Background(), "traced", func(context.Context) error { return nil })
+	assertCodeLocation(t, exporter.GetSpans()[0], "TestCodeLocation", file, line)
+
+	exporter.Reset()
+	file, line = callSite()
+	_, _ = TraceValue(context.Background(), "traced", func(context.Context) (int, error) { return 1, nil })
+	assertCodeLocation(t, exporter.GetSpans()[0], "TestCodeLocation", file, line)
+
+	exporter.Reset()
+	file, line = callSite()
+	_, span = Func(context.Background())
+	span.End()
+	if name := exporter.GetSpans()[0].Name; name != "tracker.TestCodeLocation" {
+		t.Errorf("Func span name = %q, want the calling function", name)
+	}
+	assertCodeLocation(t, exporter.GetSpans()[0], "TestCodeLocation", file, line)
+}
+
+func TestCodeLocationDisabled(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{})
+	_, span := StartSpan(context.Background(), "direct")
+	span.End()
+	_ = Trace(context.Background(), "traced", func(context.Context) error { return nil })
+	for _, span := range exporter.GetSpans() {
+		if len(span.Attributes) != 0 {
+			t.Errorf("span %q has attributes %v without the CodeLocation tag", span.Name, span.Attributes)
+		}
+	}
+}
+
+func TestSplitFunctionName(t *testing.T) {
+	tests := []struct{ name, namespace, function string }{
+		{"github.com/acme/orders.(*Service).Create", "github.com/acme/orders.(*Service)", "Create"},
+		{"github.com/acme/orders.Create.func1", "github.com/acme/orders.Create", "func1"},
+		{"main.main", "main", "main"},
+		{"github.com/acme.v2/orders.Create", "github.com/acme.v2/orders", "Create"},
+		{"noname", "", "noname"},
+	}
+	for _, tt := range tests {
+		namespace, function := splitFunctionName(tt.name)
+		if namespace != tt.namespace || function != tt.function {
+			t.Errorf("splitFunctionName(%q) = %q, %q, want %q, %q", tt.name, namespace, function, tt.namespace, tt.function)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package tracker
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log"
@@ -12,6 +13,9 @@ import (
 
 
 	"github.com/grafana/pyroscope-go"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/propagation"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -28,15 +32,24 @@ const (
 	Debug                    ConfigTag = "debug"                    // Boolean - enable debug in console
 	DebugLogFile             ConfigTag = "debugLogFile"             // Boolean - get logs files for debug mode
 	Service                  ConfigTag = "service"                  // String - Service Name e.g: "My-Service"
+	Version                  ConfigTag = "serviceVersion"           // String - Service Version e.g: "1.4.2"
 	Target                   ConfigTag = "target"                   // String - Target e.g: "app.middleware.io:443"
 	Project                  ConfigTag = "projectName"              // String - Project Name e.g: "My-Project"
 	Token                    ConfigTag = "accessToken"              // String - Token string found at agent installation
 	CustomResourceAttributes ConfigTag = "customResourceAttributes" // map[string]interface{}
+	PauseCloudDetection      ConfigTag = "pauseCloudDetection"      // Boolean - disable cloud environment detection
+	PauseDeploymentMarker    ConfigTag = "pauseDeploymentMarker"    // Boolean - disable the "service started" log event
+	BaggageAttributes        ConfigTag = "baggageAttributes"        // []string - baggage keys copied onto spans and logs e.g: []string{"tenant.id"}
+	CodeLocation             ConfigTag = "codeLocation"             // Boolean - add code.* attributes of the caller to spans started by tracker helpers
+	LogLevel                 ConfigTag = "logLevel"                 // String - minimum severity of exported logs e.g: "info"
+	StateFile                ConfigTag = "stateFile"                // String - file remembering the previous deployment e.g: "/var/lib/my-service/mw-state.json"
 )
 
 type Config struct {
 	ServiceName string
 
+	ServiceVersion string
+
 	projectName string
 
 	Host string
@@ -71,6 +84,32 @@ type Config struct {
 
 	isServerless string
 
+	pauseCloudDetection bool
+
+	container containerInfo
+
+	cloud []attribute.KeyValue
+
+	vcs vcsInfo
+
+	pauseDeploymentMarker bool
+
+	configSource string
+
+	propagatorNames []string
+
+	propagator propagation.TextMapPropagator
+
+	skipGlobalPropagator bool
+
+	baggageKeys []string
+
+	codeLocation bool
+
+	logLevel otellog.Severity
+
+	stateFile string
+
 	Tp *sdktrace.TracerProvider
 
 	Mp *sdkmetric.MeterProvider
@@ -93,7 +132,7 @@ func doesNotContainHTTP(s string) bool {
 	return !(strings.Contains(s, "http://") || strings.Contains(s, "https://"))
 }
 
-func newConfig(opts ...Options) *Config {
+func newConfig(ctx context.Context, opts ...Options) *Config {
 	c := new(Config)
 	c.pauseMetrics = false
 	c.pauseDefaultMetrics = false
@@ -112,6 +151,27 @@ func newConfig(opts ...Options) *Config {
 	for _, fn := range opts {
 		fn(c)
 	}
+	c.configSource = configSource(len(opts) > 0)
+
+	// MW_DETECTION_ROOT lets the cgroup, downward API and DMI files be read
+	// from somewhere other than "/", e.g. a fake tree.
+	detectionRoot := os.Getenv("MW_DETECTION_ROOT")
+	c.container = detectContainer(detectionRoot, os.Getenv)
+
+	if !c.pauseCloudDetection {
+		if v, ok := c.settings["pauseCloudDetection"]; ok {
+			if s, ok := v.(bool); ok {
+				c.pauseCloudDetection = s
+			}
+		}
+		// To set pauseCloudDetection via MW_DETECT_CLOUD environment variable
+		if parsedValue, err := strconv.ParseBool(os.Getenv("MW_DETECT_CLOUD")); err == nil {
+			c.pauseCloudDetection = !parsedValue
+		}
+	}
+	if !c.pauseCloudDetection {
+		c.cloud = newCloudDetector(detectionRoot, os.Getenv).detect(ctx)
+	}
 
 	if len(c.customResourceAttributes) == 0 {
 		if v, ok := c.settings["customResourceAttributes"]; ok {
@@ -172,6 +232,45 @@ func newConfig(opts ...Options) *Config {
 			c.pauseProfiling = !parsedValue
 		}
 	}
+	if !c.pauseDeploymentMarker {
+		if v, ok := c.settings["pauseDeploymentMarker"]; ok {
+			if s, ok := v.(bool); ok {
+				c.pauseDeploymentMarker = s
+			}
+		}
+	}
+	if !c.codeLocation {
+		if v, ok := c.settings["codeLocation"]; ok {
+			if s, ok := v.(bool); ok {
+				c.codeLocation = s
+			}
+		}
+		// To set codeLocation via MW_CODE_LOCATION environment variable
+		if parsedValue, err := strconv.ParseBool(os.Getenv("MW_CODE_LOCATION")); err == nil {
+			c.codeLocation = parsedValue
+		}
+	}
+	if c.logLevel == otellog.SeverityUndefined {
+		level, _ := c.settings["logLevel"].(string)
+		// To set logLevel via MW_LOG_LEVEL environment variable
+		if v := os.Getenv("MW_LOG_LEVEL"); v != "" {
+			level = v
+		}
+		if level != "" {
+			if severity, ok := parseSeverity(level); ok {
+				c.logLevel = severity
+			} else {
+				log.Println("unsupported log level: ", level)
+			}
+		}
+	}
+	if c.stateFile == "" {
+		c.stateFile, _ = c.settings["stateFile"].(string)
+		// To set stateFile via MW_STATE_FILE environment variable
+		if v := os.Getenv("MW_STATE_FILE"); v != "" {
+			c.stateFile = v
+		}
+	}
 	if !c.debug {
 		if v, ok := c.settings["debug"]; ok {
 			if s, ok := v.(bool); ok {
@@ -203,6 +302,46 @@ func newConfig(opts ...Options) *Config {
 		}
 	}
 
+	if c.propagator == nil {
+		// To set propagators via OTEL_PROPAGATORS environment variable
+		if len(c.propagatorNames) == 0 {
+			c.propagatorNames = propagatorNamesFromEnv()
+		}
+		if len(c.propagatorNames) == 0 {
+			c.propagatorNames = defaultPropagators
+		}
+		c.propagator = newPropagator(c.propagatorNames)
+	}
+
+	if len(c.baggageKeys) == 0 {
+		if v, ok := c.settings["baggageAttributes"]; ok {
+			c.baggageKeys = baggageKeysFromSetting(v)
+		}
+		// To set baggageAttributes via MW_BAGGAGE_ATTRIBUTES environment variable
+		if keys := baggageKeysFromEnv(); len(keys) > 0 {
+			c.baggageKeys = keys
+		}
+	}
+
+	c.vcs = detectVCS(os.Getenv)
+	if c.ServiceVersion == "" {
+		if v, ok := c.settings["serviceVersion"]; ok {
+			if s, ok := v.(string); ok {
+				c.ServiceVersion = s
+			}
+		}
+		// To set service version via ENV, MW_SERVICE_VERSION will have a lower priority compared to OTEL_SERVICE_VERSION
+		if envServiceVersion := os.Getenv("OTEL_SERVICE_VERSION"); envServiceVersion != "" {
+			c.ServiceVersion = envServiceVersion
+		} else if envServiceVersion := os.Getenv("MW_SERVICE_VERSION"); envServiceVersion != "" {
+			c.ServiceVersion = envServiceVersion
+		}
+		// Fall back to the main module version stamped by the Go toolchain
+		if c.ServiceVersion == "" {
+			c.ServiceVersion = c.vcs.moduleVersion
+		}
+	}
+
 	if c.target == "" {
 		if v, ok := c.settings["target"]; ok {
 			if s, ok := v.(string); ok {
@@ -220,6 +359,14 @@ func newConfig(opts ...Options) *Config {
 			os.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
 			c.target = "localhost:9319"
 			c.isServerless = "0"
+			// Inside Kubernetes the agent DaemonSet listens on the node IP.
+			// Traces, metrics and logs all go to the same agent.
+			if MW_AGENT_SERVICE == "" {
+				MW_AGENT_SERVICE = c.container.nodeIP
+			}
+			if MW_AGENT_SERVICE != "" {
+				c.fluentHost = MW_AGENT_SERVICE
+			}
 			healthAPITarget := "http://localhost:13133/healthcheck"
 			if MW_AGENT_SERVICE != "" {
 				healthAPITarget, _ = url.JoinPath("http://"+MW_AGENT_SERVICE+":13133", "healthcheck")
@@ -241,7 +388,7 @@ func newConfig(opts ...Options) *Config {
 		}
 	}
 
-	c.Host = getHostValue("MW_AGENT_SERVICE", c.target)
+	c.Host = getHostValue(MW_AGENT_SERVICE, c.target)
 	if(MW_AGENT_SERVICE != ""){
 		c.LogHost = MW_AGENT_SERVICE
 	}
@@ -330,8 +477,52 @@ func newConfig(opts ...Options) *Config {
 	return c
 }
 
-func getHostValue(key, defaultValue string) string {
-	value := os.Getenv(key)
+// configEnvKeys are the environment variables read as tracker
+// configuration, as opposed to detection inputs such as MW_DETECTION_ROOT.
+var configEnvKeys = []string{
+	"MW_AGENT_SERVICE",
+	"MW_API_KEY",
+	"MW_APM_COLLECT_LOGS",
+	"MW_APM_COLLECT_METRICS",
+	"MW_APM_COLLECT_PROFILING",
+	"MW_APM_COLLECT_TRACES",
+	"MW_AUTH_URL",
+	"MW_BAGGAGE_ATTRIBUTES",
+	"MW_CODE_LOCATION",
+	"MW_CUSTOM_RESOURCE_ATTRIBUTES",
+	"MW_DETECT_CLOUD",
+	"MW_LOG_LEVEL",
+	"MW_PROFILING_SERVER_URL",
+	"MW_SERVICE_NAME",
+	"MW_SERVICE_VERSION",
+	"MW_STATE_FILE",
+	"OTEL_PROPAGATORS",
+	"OTEL_SERVICE_NAME",
+	"OTEL_SERVICE_VERSION",
+	"OTEL_TRACES_SAMPLER",
+	"OTEL_TRACES_SAMPLER_ARG",
+}
+
+// configSource reports where the configuration came from: options passed to
+// Track, the environment variables in configEnvKeys, both, or neither.
+func configSource(hasOptions bool) string {
+	var sources []string
+	if hasOptions {
+		sources = append(sources, "code")
+	}
+	for _, key := range configEnvKeys {
+		if os.Getenv(key) != "" {
+			sources = append(sources, "env")
+			break
+		}
+	}
+	if len(sources) == 0 {
+		return "default"
+	}
+	return strings.Join(sources, "+")
+}
+
+func getHostValue(value, defaultValue string) string {
 	if len(value) == 0 {
 		return defaultValue
 	}
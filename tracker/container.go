@@ -0,0 +1,165 @@
+package tracker
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// containerInfo holds what could be learned about the container and the
+// Kubernetes pod the process is running in. Empty fields were not detected.
+type containerInfo struct {
+	containerID  string
+	podName      string
+	podNamespace string
+	podUID       string
+	nodeName     string
+	nodeIP       string
+}
+
+var (
+	containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+	// Pod UIDs appear as "pod<uid>" in cgroupfs paths and with underscores
+	// instead of dashes when the kubelet uses the systemd cgroup driver.
+	podUIDPattern = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// Downward API environment variables, in order of preference.
+var (
+	podNameEnvs      = []string{"K8S_POD_NAME", "MW_K8S_POD_NAME", "POD_NAME"}
+	podNamespaceEnvs = []string{"K8S_NAMESPACE_NAME", "K8S_POD_NAMESPACE", "MW_K8S_NAMESPACE", "POD_NAMESPACE"}
+	podUIDEnvs       = []string{"K8S_POD_UID", "MW_K8S_POD_UID", "POD_UID"}
+	nodeNameEnvs     = []string{"K8S_NODE_NAME", "MW_K8S_NODE_NAME", "NODE_NAME"}
+	// Generic names such as NODE_IP or HOST_IP are often set for other
+	// purposes, and the node IP decides where telemetry is sent.
+	nodeIPEnvs = []string{"K8S_NODE_IP", "MW_K8S_NODE_IP"}
+)
+
+// detectContainer reads container and pod metadata from the cgroup and mount
+// tables under root (normally "/") and from the Kubernetes downward API,
+// exposed either as environment variables or as files in /etc/podinfo.
+func detectContainer(root string, getenv func(string) string) containerInfo {
+	if root == "" {
+		root = "/"
+	}
+	var info containerInfo
+
+	cgroup := readFile(filepath.Join(root, "proc", "self", "cgroup"))
+	info.containerID = containerIDFromCgroup(cgroup)
+	if info.containerID == "" {
+		info.containerID = containerIDFromMountinfo(readFile(filepath.Join(root, "proc", "self", "mountinfo")))
+	}
+
+	podinfo := filepath.Join(root, "etc", "podinfo")
+	info.podName = firstEnv(getenv, podNameEnvs)
+	if info.podName == "" {
+		info.podName = readFileTrimmed(filepath.Join(podinfo, "name"))
+	}
+	info.podNamespace = firstEnv(getenv, podNamespaceEnvs)
+	if info.podNamespace == "" {
+		info.podNamespace = readFileTrimmed(filepath.Join(podinfo, "namespace"))
+	}
+	if info.podNamespace == "" {
+		info.podNamespace = readFileTrimmed(filepath.Join(root, "var", "run", "secrets", "kubernetes.io", "serviceaccount", "namespace"))
+	}
+	info.podUID = firstEnv(getenv, podUIDEnvs)
+	if info.podUID == "" {
+		info.podUID = readFileTrimmed(filepath.Join(podinfo, "uid"))
+	}
+	if info.podUID == "" {
+		if m := podUIDPattern.FindStringSubmatch(cgroup); m != nil {
+			info.podUID = strings.ReplaceAll(m[1], "_", "-")
+		}
+	}
+	info.nodeName = firstEnv(getenv, nodeNameEnvs)
+	info.nodeIP = firstEnv(getenv, nodeIPEnvs)
+
+	// Pods get their name as hostname unless hostNetwork is used.
+	if info.podName == "" && getenv("KUBERNETES_SERVICE_HOST") != "" {
+		info.podName = getenv("HOSTNAME")
+	}
+	return info
+}
+
+// containerIDFromCgroup returns the last container ID found in a
+// /proc/self/cgroup listing. This covers cgroup v1 and hybrid hierarchies
+// for docker, containerd and cri-o.
+func containerIDFromCgroup(cgroup string) string {
+	var id string
+	for _, line := range strings.Split(cgroup, "\n") {
+		if ids := containerIDPattern.FindAllString(line, -1); len(ids) > 0 {
+			id = ids[len(ids)-1]
+		}
+	}
+	return id
+}
+
+// containerIDFromMountinfo handles cgroup v2, where /proc/self/cgroup is
+// just "0::/", by looking at the bind mounts the runtime sets up for the
+// container's hostname, hosts and resolv.conf files.
+func containerIDFromMountinfo(mountinfo string) string {
+	scanner := bufio.NewScanner(strings.NewReader(mountinfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountRoot := fields[3]
+		if !strings.HasSuffix(mountRoot, "/hostname") &&
+			!strings.HasSuffix(mountRoot, "/hosts") &&
+			!strings.HasSuffix(mountRoot, "/resolv.conf") {
+			continue
+		}
+		if strings.Contains(mountRoot, "/containers/") {
+			if id := containerIDPattern.FindString(mountRoot); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// attributes returns the detected values as resource attributes.
+func (i containerInfo) attributes() []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+	add := func(key, value string) {
+		if value != "" {
+			attributes = append(attributes, attribute.String(key, value))
+		}
+	}
+	add("container.id", i.containerID)
+	add("k8s.pod.name", i.podName)
+	add("k8s.namespace.name", i.podNamespace)
+	add("k8s.pod.uid", i.podUID)
+	add("k8s.node.name", i.nodeName)
+	return attributes
+}
+
+func addContainerAttributes(attributes []attribute.KeyValue, c *Config) []attribute.KeyValue {
+	return append(attributes, c.container.attributes()...)
+}
+
+func firstEnv(getenv func(string) string, keys []string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(getenv(key)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func readFile(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func readFileTrimmed(path string) string {
+	return strings.TrimSpace(readFile(path))
+}
@@ -0,0 +1,94 @@
+package tracker
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectContainer(t *testing.T) {
+	tests := []struct {
+		name string
+		root string
+		env  map[string]string
+		want containerInfo
+	}{
+		{
+			name: "cgroup v1",
+			root: "cgroupv1",
+			want: containerInfo{containerID: "3e74d3fd9db4c9dd921ae05c2502fb984d0cde1b36e581b13f79c639da4518a1"},
+		},
+		{
+			name: "cgroup v2 mountinfo",
+			root: "cgroupv2",
+			want: containerInfo{containerID: "1e6b6d0a6f9bc8a2c0e7c4d7a1b0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2"},
+		},
+		{
+			name: "systemd cgroup driver",
+			root: "systemd",
+			want: containerInfo{
+				containerID: "b0b5a8fd7b6bb3f6d1f2c8e0f7f7cb0d5b7a1d7b3f2e4c6d8a9b0c1d2e3f4a5b",
+				podUID:      "7c1f8a2e-4b3d-4e5f-9a8b-1c2d3e4f5a6b",
+			},
+		},
+		{
+			name: "podinfo files",
+			root: "podinfo",
+			want: containerInfo{
+				podName:      "checkout-7d9f8b6c5-x2k4q",
+				podNamespace: "shop",
+				podUID:       "0f1e2d3c-4b5a-6978-8695-a4b3c2d1e0f9",
+			},
+		},
+		{
+			name: "downward API environment",
+			root: "podinfo",
+			env: map[string]string{
+				"K8S_POD_NAME":       "api-0",
+				"K8S_NAMESPACE_NAME": "prod",
+				"K8S_POD_UID":        "11111111-2222-3333-4444-555555555555",
+				"K8S_NODE_NAME":      "node-a",
+				"K8S_NODE_IP":        "10.0.0.7",
+			},
+			want: containerInfo{
+				podName:      "api-0",
+				podNamespace: "prod",
+				podUID:       "11111111-2222-3333-4444-555555555555",
+				nodeName:     "node-a",
+				nodeIP:       "10.0.0.7",
+			},
+		},
+		{
+			name: "hostname fallback",
+			root: "cgroupv1",
+			env: map[string]string{
+				"KUBERNETES_SERVICE_HOST": "10.96.0.1",
+				"HOSTNAME":                "worker-5f6d",
+			},
+			want: containerInfo{
+				containerID: "3e74d3fd9db4c9dd921ae05c2502fb984d0cde1b36e581b13f79c639da4518a1",
+				podName:     "worker-5f6d",
+			},
+		},
+		{
+			name: "generic node IP variables",
+			root: "missing",
+			env: map[string]string{
+				"NODE_IP": "10.0.0.8",
+				"HOST_IP": "10.0.0.9",
+			},
+		},
+		{
+			name: "not a container",
+			root: "missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+			got := detectContainer(filepath.Join("testdata", "container", tt.root), getenv)
+			if got != tt.want {
+				t.Errorf("detectContainer() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package tracker
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type contextAttributesKey struct{}
+
+// WithAttributes returns a copy of ctx carrying attrs in addition to the
+// attributes already attached to it; a key set again replaces the previous
+// value. Spans started and log records emitted under the returned context,
+// and metrics recorded through the tracker helpers, carry these attributes.
+// Attach them once at the request boundary:
+//
+//	ctx = tracker.WithAttributes(ctx, tracker.String("tenant.id", tenant))
+func WithAttributes(ctx context.Context, attrs ...attribute.KeyValue) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+	merged := append(AttributesFromContext(ctx), attrs...)
+	set := attribute.NewSet(merged...)
+	return context.WithValue(ctx, contextAttributesKey{}, &set)
+}
+
+// AttributesFromContext returns the attributes attached to ctx with
+// WithAttributes.
+func AttributesFromContext(ctx context.Context) []attribute.KeyValue {
+	if set, ok := ctx.Value(contextAttributesKey{}).(*attribute.Set); ok {
+		return set.ToSlice()
+	}
+	return nil
+}
+
+// ContextAttributesSpanProcessor adds the attributes attached with
+// WithAttributes to every span when it starts.
+type ContextAttributesSpanProcessor struct{}
+
+var _ sdktrace.SpanProcessor = ContextAttributesSpanProcessor{}
+
+func (ContextAttributesSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if attrs := AttributesFromContext(ctx); len(attrs) > 0 {
+		s.SetAttributes(attrs...)
+	}
+}
+
+func (ContextAttributesSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (ContextAttributesSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (ContextAttributesSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// ContextAttributesLogProcessor adds the attributes attached with
+// WithAttributes to every log record emitted with that context, e.g. through
+// the mwotelslog, mwotelzap and mwotellogrus bridges. It must be registered
+// before the exporting processors.
+type ContextAttributesLogProcessor struct{}
+
+var _ sdklog.Processor = ContextAttributesLogProcessor{}
+
+func (ContextAttributesLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	for _, kv := range AttributesFromContext(ctx) {
+		r.AddAttributes(logKeyValue(kv))
+	}
+	return nil
+}
+
+func (ContextAttributesLogProcessor) Shutdown(context.Context) error { return nil }
+
+func (ContextAttributesLogProcessor) ForceFlush(context.Context) error { return nil }
+
+// logKeyValue converts a trace/metric attribute into a log attribute.
+func logKeyValue(kv attribute.KeyValue) otellog.KeyValue {
+	key := string(kv.Key)
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		return otellog.Bool(key, kv.Value.AsBool())
+	case attribute.INT64:
+		return otellog.Int64(key, kv.Value.AsInt64())
+	case attribute.FLOAT64:
+		return otellog.Float64(key, kv.Value.AsFloat64())
+	case attribute.STRING:
+		return otellog.String(key, kv.Value.AsString())
+	case attribute.BOOLSLICE:
+		values := kv.Value.AsBoolSlice()
+		out := make([]otellog.Value, len(values))
+		for i, v := range values {
+			out[i] = otellog.BoolValue(v)
+		}
+		return otellog.Slice(key, out...)
+	case attribute.INT64SLICE:
+		values := kv.Value.AsInt64Slice()
+		out := make([]otellog.Value, len(values))
+		for i, v := range values {
+			out[i] = otellog.Int64Value(v)
+		}
+		return otellog.Slice(key, out...)
+	case attribute.FLOAT64SLICE:
+		values := kv.Value.AsFloat64Slice()
+		out := make([]otellog.Value, len(values))
+		for i, v := range values {
+			out[i] = otellog.Float64Value(v)
+		}
+		return otellog.Slice(key, out...)
+	case attribute.STRINGSLICE:
+		values := kv.Value.AsStringSlice()
+		out := make([]otellog.Value, len(values))
+		for i, v := range values {
+			out[i] = otellog.StringValue(v)
+		}
+		return otellog.Slice(key, out...)
+	}
+	return otellog.String(key, kv.Value.Emit())
+}
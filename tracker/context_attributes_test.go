@@ -0,0 +1,144 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func tenantContext() context.Context {
+	ctx := WithAttributes(context.Background(), String("tenant.id", "acme"), String("plan", "free"))
+	// A key set again replaces the previous value.
+	return WithAttributes(ctx, String("plan", "gold"), Int("shard", 3))
+}
+
+func TestAttributesFromContext(t *testing.T) {
+	got := attribute.NewSet(AttributesFromContext(tenantContext())...)
+	want := attribute.NewSet(String("tenant.id", "acme"), String("plan", "gold"), Int("shard", 3))
+	if !got.Equals(&want) {
+		t.Errorf("AttributesFromContext() = %v, want %v", got.ToSlice(), want.ToSlice())
+	}
+	if attrs := AttributesFromContext(context.Background()); attrs != nil {
+		t.Errorf("AttributesFromContext(Background) = %v, want nil", attrs)
+	}
+	ctx := context.Background()
+	if WithAttributes(ctx) != ctx {
+		t.Error("WithAttributes without attributes returned a new context")
+	}
+}
+
+func TestContextAttributesSpanProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(ContextAttributesSpanProcessor{}),
+		sdktrace.WithSyncer(exporter),
+	)
+	_, span := tp.Tracer("test").Start(tenantContext(), "checkout")
+	span.End()
+	_, span = tp.Tracer("test").Start(context.Background(), "health")
+	span.End()
+
+	spans := exporter.GetSpans()
+	assertAttributes(t, attributeMap(spans[0].Attributes), map[string]string{"tenant.id": "acme", "plan": "gold", "shard": "3"})
+	if len(spans[1].Attributes) != 0 {
+		t.Errorf("span without context attributes has %v", spans[1].Attributes)
+	}
+}
+
+func TestContextAttributesLogProcessor(t *testing.T) {
+	lp, recorder := newLogRecorder(ContextAttributesLogProcessor{})
+	var record otellog.Record
+	record.SetBody(otellog.StringValue("order placed"))
+	lp.Logger("test").Emit(tenantContext(), record)
+
+	attrs := recordAttributes(recorder.Records()[0].WalkAttributes)
+	if attrs["tenant.id"].AsString() != "acme" || attrs["plan"].AsString() != "gold" || attrs["shard"].AsInt64() != 3 {
+		t.Errorf("log attributes = %v, want the context attributes", attrs)
+	}
+}
+
+func TestLogKeyValue(t *testing.T) {
+	tests := []struct {
+		kv   attribute.KeyValue
+		want otellog.KeyValue
+	}{
+		{attribute.Bool("k", true), otellog.Bool("k", true)},
+		{attribute.Float64("k", 0.5), otellog.Float64("k", 0.5)},
+		{attribute.StringSlice("k", []string{"a", "b"}), otellog.Slice("k", otellog.StringValue("a"), otellog.StringValue("b"))},
+		{attribute.Int64Slice("k", []int64{1}), otellog.Slice("k", otellog.Int64Value(1))},
+	}
+	for _, tt := range tests {
+		if got := logKeyValue(tt.kv); !got.Equal(tt.want) {
+			t.Errorf("logKeyValue(%v) = %v, want %v", tt.kv, got, tt.want)
+		}
+	}
+}
+
+// withTestMeterProvider makes a provider reading into the returned reader
+// the active one until the end of the test.
+func withTestMeterProvider(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	activeMeterProvider.Store(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { activeMeterProvider.Store(nil) })
+	return reader
+}
+
+func collectMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("metric %s was not recorded", name)
+	return nil
+}
+
+func TestMetricAttributes(t *testing.T) {
+	reader := withTestMeterProvider(t)
+	ctx := tenantContext()
+	Count(ctx, "orders", 2, String("status", "paid"))
+	Count(ctx, "orders", 1, String("status", "paid"))
+	Record(ctx, "order.amount", 12.5, String("currency", "EUR"))
+
+	sum, ok := collectMetric(t, reader, "orders").(metricdata.Sum[int64])
+	if !ok || len(sum.DataPoints) != 1 {
+		t.Fatalf("orders = %v, want one counter data point", sum)
+	}
+	want := attribute.NewSet(String("tenant.id", "acme"), String("plan", "gold"), Int("shard", 3), String("status", "paid"))
+	if point := sum.DataPoints[0]; point.Value != 3 || !point.Attributes.Equals(&want) {
+		t.Errorf("orders = %d %v, want 3 %v", point.Value, point.Attributes.ToSlice(), want.ToSlice())
+	}
+
+	histogram, ok := collectMetric(t, reader, "order.amount").(metricdata.Histogram[float64])
+	if !ok || len(histogram.DataPoints) != 1 {
+		t.Fatalf("order.amount = %v, want one histogram data point", histogram)
+	}
+	want = attribute.NewSet(String("tenant.id", "acme"), String("plan", "gold"), Int("shard", 3), String("currency", "EUR"))
+	if point := histogram.DataPoints[0]; point.Sum != 12.5 || !point.Attributes.Equals(&want) {
+		t.Errorf("order.amount = %v %v, want 12.5 %v", point.Sum, point.Attributes.ToSlice(), want.ToSlice())
+	}
+}
+
+func TestMetricAttributesOverride(t *testing.T) {
+	reader := withTestMeterProvider(t)
+	// Explicit attributes take precedence over the context ones.
+	Count(tenantContext(), "logins", 1, String("plan", "trial"))
+	sum := collectMetric(t, reader, "logins").(metricdata.Sum[int64])
+	if plan, _ := sum.DataPoints[0].Attributes.Value("plan"); plan.AsString() != "trial" {
+		t.Errorf("plan = %q, want the explicit attribute", plan.AsString())
+	}
+}
@@ -0,0 +1,127 @@
+package tracker
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type debugKey struct{}
+
+// WithDebug marks ctx for debugging: spans started under it are always
+// sampled and log records emitted with it are exported regardless of the
+// LogLevel config tag. It is meant for single requests, e.g. those carrying
+// a debug header checked by mwhttp.
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+// DebugFromContext reports whether ctx was marked with WithDebug.
+func DebugFromContext(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugKey{}).(bool)
+	return debug
+}
+
+// debugSampler samples every span started under a context marked with
+// WithDebug and defers to base for the others.
+type debugSampler struct {
+	base sdktrace.Sampler
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if DebugFromContext(p.ParentContext) {
+		result := s.base.ShouldSample(p)
+		result.Decision = sdktrace.RecordAndSample
+		result.Attributes = append(result.Attributes, attribute.Bool("mw.debug", true))
+		return result
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s debugSampler) Description() string {
+	return "DebugSampler{" + s.base.Description() + "}"
+}
+
+// samplerFromEnv returns the sampler selected by OTEL_TRACES_SAMPLER and
+// OTEL_TRACES_SAMPLER_ARG, or the SDK default of sampling everything unless
+// the parent was not sampled.
+func samplerFromEnv() sdktrace.Sampler {
+	ratio := func() float64 {
+		arg := os.Getenv("OTEL_TRACES_SAMPLER_ARG")
+		if arg == "" {
+			return 1
+		}
+		r, err := strconv.ParseFloat(arg, 64)
+		if err != nil || r < 0 || r > 1 {
+			log.Printf("invalid OTEL_TRACES_SAMPLER_ARG: %s\n", arg)
+			return 1
+		}
+		return r
+	}
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER"))); name {
+	case "always_on":
+		return sdktrace.AlwaysSample()
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio())
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio()))
+	case "", "parentbased_always_on":
+	default:
+		log.Printf("unsupported sampler: %s\n", name)
+	}
+	return sdktrace.ParentBased(sdktrace.AlwaysSample())
+}
+
+// severityFilter drops records below min before they reach next, unless they
+// were emitted with a context marked with WithDebug.
+type severityFilter struct {
+	sdklog.Processor
+	min otellog.Severity
+}
+
+// newSeverityFilter wraps an exporting processor. With no minimum severity
+// configured every record is exported and next is returned as is.
+func newSeverityFilter(min otellog.Severity, next sdklog.Processor) sdklog.Processor {
+	if min == otellog.SeverityUndefined {
+		return next
+	}
+	return severityFilter{Processor: next, min: min}
+}
+
+func (f severityFilter) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	// Records without a severity are kept, they cannot be compared.
+	if r.Severity() != otellog.SeverityUndefined && r.Severity() < f.min && !DebugFromContext(ctx) {
+		return nil
+	}
+	return f.Processor.OnEmit(ctx, r)
+}
+
+// parseSeverity parses a log level name such as "debug" or "warn".
+func parseSeverity(level string) (otellog.Severity, bool) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "trace":
+		return otellog.SeverityTrace, true
+	case "debug":
+		return otellog.SeverityDebug, true
+	case "info":
+		return otellog.SeverityInfo, true
+	case "warn", "warning":
+		return otellog.SeverityWarn, true
+	case "error":
+		return otellog.SeverityError, true
+	case "fatal":
+		return otellog.SeverityFatal, true
+	}
+	return otellog.SeverityUndefined, false
+}
@@ -0,0 +1,127 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDebugSampler(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(debugSampler{base: sdktrace.NeverSample()}),
+		sdktrace.WithSyncer(exporter),
+	)
+	_, span := tp.Tracer("test").Start(context.Background(), "regular")
+	if span.IsRecording() || span.SpanContext().IsSampled() {
+		t.Error("span without debug was sampled by a NeverSample base")
+	}
+	span.End()
+	_, span = tp.Tracer("test").Start(WithDebug(context.Background()), "debug")
+	if !span.IsRecording() || !span.SpanContext().IsSampled() {
+		t.Error("span under WithDebug was not recorded and sampled")
+	}
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "debug" {
+		t.Fatalf("got spans %v, want only the debug span", spans)
+	}
+	if got := attributeMap(spans[0].Attributes)["mw.debug"]; got != "true" {
+		t.Errorf("mw.debug = %q, want true", got)
+	}
+	if got := (debugSampler{base: sdktrace.AlwaysSample()}).Description(); got != "DebugSampler{AlwaysOnSampler}" {
+		t.Errorf("Description() = %q", got)
+	}
+}
+
+func TestSamplerFromEnv(t *testing.T) {
+	tests := []struct {
+		sampler, arg, want string
+	}{
+		{"", "", "ParentBased{root:AlwaysOnSampler,remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}"},
+		{"always_on", "", "AlwaysOnSampler"},
+		{" ALWAYS_OFF ", "", "AlwaysOffSampler"},
+		{"traceidratio", "0.25", "TraceIDRatioBased{0.25}"},
+		{"traceidratio", "2", "AlwaysOnSampler"},
+		{"traceidratio", "half", "AlwaysOnSampler"},
+		{"parentbased_always_off", "", "ParentBased{root:AlwaysOffSampler,remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}"},
+		{"parentbased_traceidratio", "0.5", "ParentBased{root:TraceIDRatioBased{0.5},remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}"},
+		{"jaeger_remote", "", "ParentBased{root:AlwaysOnSampler,remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}"},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+		t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+		if got := samplerFromEnv().Description(); got != tt.want {
+			t.Errorf("OTEL_TRACES_SAMPLER=%q OTEL_TRACES_SAMPLER_ARG=%q: sampler = %s, want %s", tt.sampler, tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		tag  string
+		want otellog.Severity
+	}{
+		{"unset", "", "", otellog.SeverityUndefined},
+		{"config tag", "", "info", otellog.SeverityInfo},
+		{"MW_LOG_LEVEL", " WARNING ", "", otellog.SeverityWarn},
+		{"MW_LOG_LEVEL takes precedence", "error", "debug", otellog.SeverityError},
+		{"unsupported", "verbose", "", otellog.SeverityUndefined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MW_LOG_LEVEL", tt.env)
+			var opts []Options
+			if tt.tag != "" {
+				opts = append(opts, WithConfigTag(LogLevel, tt.tag))
+			}
+			if got := trackForTest(t, opts...).logLevel; got != tt.want {
+				t.Errorf("log level = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeverityFilter(t *testing.T) {
+	recorder := &logRecorder{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(newSeverityFilter(otellog.SeverityWarn, sdklog.NewSimpleProcessor(recorder))))
+	emit := func(ctx context.Context, severity otellog.Severity, body string) {
+		var record otellog.Record
+		record.SetSeverity(severity)
+		record.SetBody(otellog.StringValue(body))
+		lp.Logger("test").Emit(ctx, record)
+	}
+	emit(context.Background(), otellog.SeverityDebug, "dropped")
+	emit(context.Background(), otellog.SeverityInfo, "dropped")
+	emit(context.Background(), otellog.SeverityWarn, "warn")
+	emit(context.Background(), otellog.SeverityError, "error")
+	emit(context.Background(), otellog.SeverityUndefined, "no severity")
+	emit(WithDebug(context.Background()), otellog.SeverityDebug, "debug request")
+
+	var got []string
+	for _, r := range recorder.Records() {
+		got = append(got, r.Body().AsString())
+	}
+	want := []string{"warn", "error", "no severity", "debug request"}
+	if len(got) != len(want) {
+		t.Fatalf("exported %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("exported %q, want %q", got, want)
+			break
+		}
+	}
+
+	next := sdklog.NewSimpleProcessor(recorder)
+	if newSeverityFilter(otellog.SeverityUndefined, next) != next {
+		t.Error("newSeverityFilter wrapped the processor without a minimum severity")
+	}
+}
@@ -0,0 +1,149 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+)
+
+var deploymentMarkerOnce sync.Once
+
+// deploymentState is what is remembered between runs to recognise new
+// deployments.
+type deploymentState struct {
+	ServiceName    string    `json:"service_name"`
+	ServiceVersion string    `json:"service_version,omitempty"`
+	CommitSHA      string    `json:"commit_sha,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+}
+
+// emitDeploymentMarker emits a single "service started" log record per
+// process through the tracker's logger provider, so that deployments can be
+// overlaid on dashboards.
+func emitDeploymentMarker(ctx context.Context, c *Config) {
+	if c.Lp == nil {
+		return
+	}
+	deploymentMarkerOnce.Do(func() {
+		record := deploymentMarker(c, time.Now())
+		c.Lp.Logger(instrumentationName, otellog.WithInstrumentationVersion(instrumentationVersion())).Emit(ctx, record)
+	})
+}
+
+// deploymentMarker returns the "service started" record and replaces the
+// state file. The record is flagged as a new deployment when the commit
+// differs from the one stored in the state file by the previous run.
+func deploymentMarker(c *Config, now time.Time) otellog.Record {
+	current := deploymentState{
+		ServiceName:    c.ServiceName,
+		ServiceVersion: c.ServiceVersion,
+		CommitSHA:      c.vcs.commitSHA,
+		StartedAt:      now,
+	}
+	path := deploymentStatePath(c.stateFile, c.ServiceName)
+	previous, found := readDeploymentState(path)
+	isNew := !found || previous.revision() != current.revision()
+	if err := writeDeploymentState(path, current); err != nil {
+		log.Println("failed to write deployment state: ", err)
+	}
+
+	attributes := []otellog.KeyValue{
+		otellog.String("event.name", "service.started"),
+		otellog.String("service.name", c.ServiceName),
+		otellog.String("service.version", c.ServiceVersion),
+		otellog.String("vcs.commit_sha", c.vcs.commitSHA),
+		otellog.String("process.runtime.version", runtime.Version()),
+		otellog.Int("go.maxprocs", runtime.GOMAXPROCS(0)),
+		otellog.Slice("mw.signals", c.enabledSignals()...),
+		otellog.String("mw.config_source", c.configSource),
+		otellog.Bool("deployment.new", isNew),
+	}
+	if found && previous.CommitSHA != "" {
+		attributes = append(attributes, otellog.String("deployment.previous_commit_sha", previous.CommitSHA))
+	}
+
+	var record otellog.Record
+	record.SetTimestamp(current.StartedAt)
+	record.SetSeverity(otellog.SeverityInfo)
+	record.SetSeverityText("INFO")
+	record.SetBody(otellog.StringValue("service started"))
+	record.AddAttributes(attributes...)
+	return record
+}
+
+// revision identifies the deployed code, preferring the commit over the
+// version when both are known.
+func (s deploymentState) revision() string {
+	if s.CommitSHA != "" {
+		return s.CommitSHA
+	}
+	return s.ServiceVersion
+}
+
+func (c *Config) enabledSignals() []otellog.Value {
+	var signals []otellog.Value
+	if !c.pauseTraces {
+		signals = append(signals, otellog.StringValue("traces"))
+	}
+	if !c.pauseLogs {
+		signals = append(signals, otellog.StringValue("logs"))
+	}
+	if !c.pauseMetrics {
+		signals = append(signals, otellog.StringValue("metrics"))
+	}
+	if !c.pauseProfiling && c.TenantID != "" {
+		signals = append(signals, otellog.StringValue("profiling"))
+	}
+	return signals
+}
+
+// deploymentStatePath returns the configured state file or a per-service
+// file in the user cache directory. The cache directory rarely outlives a
+// container, so in containers stateFile should be on a persistent volume.
+func deploymentStatePath(stateFile, serviceName string) string {
+	if stateFile != "" {
+		return stateFile
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r == ':' {
+			return '-'
+		}
+		return r
+	}, serviceName)
+	return filepath.Join(dir, "middleware", name+".json")
+}
+
+func readDeploymentState(path string) (deploymentState, bool) {
+	var state deploymentState
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return state, false
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, false
+	}
+	return state, true
+}
+
+func writeDeploymentState(path string, state deploymentState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
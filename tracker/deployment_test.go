@@ -0,0 +1,194 @@
+package tracker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// logRecorder is a log exporter keeping the exported records in memory.
+type logRecorder struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (r *logRecorder) Export(ctx context.Context, records []sdklog.Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range records {
+		r.records = append(r.records, record.Clone())
+	}
+	return nil
+}
+
+func (r *logRecorder) Shutdown(context.Context) error   { return nil }
+func (r *logRecorder) ForceFlush(context.Context) error { return nil }
+
+func (r *logRecorder) Records() []sdklog.Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]sdklog.Record(nil), r.records...)
+}
+
+// newLogRecorder returns a logger provider exporting synchronously to the
+// returned recorder after running processors.
+func newLogRecorder(processors ...sdklog.Processor) (*sdklog.LoggerProvider, *logRecorder) {
+	recorder := &logRecorder{}
+	opts := make([]sdklog.LoggerProviderOption, 0, len(processors)+1)
+	for _, p := range processors {
+		opts = append(opts, sdklog.WithProcessor(p))
+	}
+	opts = append(opts, sdklog.WithProcessor(sdklog.NewSimpleProcessor(recorder)))
+	return sdklog.NewLoggerProvider(opts...), recorder
+}
+
+// recordAttributes returns the attributes of a record by key.
+func recordAttributes(walk func(func(otellog.KeyValue) bool)) map[string]otellog.Value {
+	attributes := map[string]otellog.Value{}
+	walk(func(kv otellog.KeyValue) bool {
+		attributes[kv.Key] = kv.Value
+		return true
+	})
+	return attributes
+}
+
+func TestConfigSource(t *testing.T) {
+	for _, key := range configEnvKeys {
+		t.Setenv(key, "")
+	}
+	// Unrelated variables with the same prefixes do not count.
+	t.Setenv("MW_DETECTION_ROOT", "/tmp/root")
+	t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+	if got := configSource(false); got != "default" {
+		t.Errorf("configSource(false) = %q, want default", got)
+	}
+	if got := configSource(true); got != "code" {
+		t.Errorf("configSource(true) = %q, want code", got)
+	}
+	t.Setenv("MW_SERVICE_NAME", "checkout")
+	if got := configSource(true); got != "code+env" {
+		t.Errorf("configSource(true) = %q, want code+env", got)
+	}
+}
+
+func TestDeploymentStatePath(t *testing.T) {
+	if got := deploymentStatePath("/data/state.json", "checkout"); got != "/data/state.json" {
+		t.Errorf("deploymentStatePath() = %q, want the configured file", got)
+	}
+	// os.UserCacheDir only honours XDG_CACHE_HOME on Linux.
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG_CACHE_HOME is not used on " + runtime.GOOS)
+	}
+	t.Setenv("XDG_CACHE_HOME", "/cache")
+	t.Setenv("HOME", "/home/app")
+	if got, want := deploymentStatePath("", "shop/checkout api"), "/cache/middleware/shop-checkout-api.json"; got != want {
+		t.Errorf("deploymentStatePath() = %q, want %q", got, want)
+	}
+}
+
+func TestDeploymentMarker(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state", "checkout.json")
+	start := func(version, commit string) map[string]otellog.Value {
+		c := &Config{ServiceName: "checkout", ServiceVersion: version, stateFile: stateFile, configSource: "code"}
+		c.vcs.commitSHA = commit
+		record := deploymentMarker(c, time.Now())
+		return recordAttributes(record.WalkAttributes)
+	}
+	steps := []struct {
+		name     string
+		version  string
+		commit   string
+		isNew    bool
+		previous string
+	}{
+		{name: "first start", version: "1.0.0", commit: "aaa", isNew: true},
+		{name: "restart", version: "1.0.0", commit: "aaa", previous: "aaa"},
+		{name: "new commit", version: "1.0.0", commit: "bbb", isNew: true, previous: "aaa"},
+		// Without a commit the version identifies the deployment.
+		{name: "unknown commit", version: "1.0.0", isNew: true, previous: "bbb"},
+		{name: "restart without commit", version: "1.0.0"},
+		{name: "new version", version: "1.1.0", isNew: true},
+	}
+	for _, step := range steps {
+		attributes := start(step.version, step.commit)
+		if got := attributes["deployment.new"].AsBool(); got != step.isNew {
+			t.Errorf("%s: deployment.new = %v, want %v", step.name, got, step.isNew)
+		}
+		previous, ok := attributes["deployment.previous_commit_sha"]
+		if got := previous.AsString(); ok != (step.previous != "") || got != step.previous {
+			t.Errorf("%s: deployment.previous_commit_sha = %q, want %q", step.name, got, step.previous)
+		}
+		if got := attributes["vcs.commit_sha"].AsString(); got != step.commit {
+			t.Errorf("%s: vcs.commit_sha = %q, want %q", step.name, got, step.commit)
+		}
+	}
+
+	state, ok := readDeploymentState(stateFile)
+	if !ok || state.ServiceName != "checkout" || state.ServiceVersion != "1.1.0" || state.CommitSHA != "" {
+		t.Errorf("state file = %+v, want the last start", state)
+	}
+
+	// A corrupt state file counts as a first start.
+	if err := os.WriteFile(stateFile, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if attributes := start("1.1.0", "ccc"); !attributes["deployment.new"].AsBool() {
+		t.Error("start after a corrupt state file is not a new deployment")
+	}
+}
+
+func TestEmitDeploymentMarker(t *testing.T) {
+	lp, recorder := newLogRecorder()
+	c := &Config{
+		ServiceName:    "checkout",
+		ServiceVersion: "1.0.0",
+		Lp:             lp,
+		stateFile:      filepath.Join(t.TempDir(), "checkout.json"),
+		configSource:   "env",
+		pauseMetrics:   true,
+	}
+	emitDeploymentMarker(context.Background(), c)
+	// Only the first call of a process emits a record.
+	emitDeploymentMarker(context.Background(), c)
+
+	records := recorder.Records()
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	record := records[0]
+	if got := record.Body().AsString(); got != "service started" {
+		t.Errorf("body = %q, want %q", got, "service started")
+	}
+	if record.Severity() != otellog.SeverityInfo {
+		t.Errorf("severity = %v, want INFO", record.Severity())
+	}
+	attributes := recordAttributes(record.WalkAttributes)
+	for key, want := range map[string]string{
+		"event.name":              "service.started",
+		"service.name":            "checkout",
+		"service.version":         "1.0.0",
+		"process.runtime.version": runtime.Version(),
+		"mw.config_source":        "env",
+	} {
+		if got := attributes[key].AsString(); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	var signals []string
+	for _, v := range attributes["mw.signals"].AsSlice() {
+		signals = append(signals, v.AsString())
+	}
+	if len(signals) != 2 || signals[0] != "traces" || signals[1] != "logs" {
+		t.Errorf("mw.signals = %q, want traces and logs", signals)
+	}
+	if got := attributes["go.maxprocs"].AsInt64(); got != int64(runtime.GOMAXPROCS(0)) {
+		t.Errorf("go.maxprocs = %d, want %d", got, runtime.GOMAXPROCS(0))
+	}
+}
@@ -0,0 +1,39 @@
+package tracker
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Detach returns a context for work that outlives the request of ctx, such
+// as audit writes or cache warming. It is never cancelled and has no
+// deadline, but keeps the values of ctx: baggage, the attributes attached
+// with WithAttributes and the span context, so spans started under it stay
+// in the request's trace. The request's span itself is replaced by its
+// non-recording span context, since it usually ends before the detached work
+// does.
+func Detach(ctx context.Context) context.Context {
+	ctx = context.WithoutCancel(ctx)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, sc)
+	}
+	return ctx
+}
+
+// GoDetached runs fn in a new goroutine under a span named name, a child of
+// the span in ctx, with a context detached from ctx by Detach. An error
+// returned by fn is recorded with ErrorRecording, and a panic is reported
+// like RecoverAndReport.
+//
+//	tracker.GoDetached(r.Context(), "audit", func(ctx context.Context) error {
+//		return audit.Write(ctx, entry)
+//	})
+func GoDetached(ctx context.Context, name string, fn func(ctx context.Context) error, opts ...trace.SpanStartOption) {
+	ctx, span := startSpan(Detach(ctx), name, 1, opts)
+	go func() {
+		defer RecoverAndReport(ctx)
+		ErrorRecording(ctx, fn(ctx))
+		span.End()
+	}()
+}
@@ -0,0 +1,110 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDetach(t *testing.T) {
+	withActiveConfig(t, &Config{})
+	ctx, cancel := context.WithTimeout(baggageContext(t), time.Minute)
+	ctx = WithAttributes(ctx, String("tenant.id", "acme"))
+	ctx, span := StartSpan(ctx, "request")
+	defer span.End()
+
+	detached := Detach(ctx)
+	cancel()
+	if ctx.Err() == nil {
+		t.Fatal("parent context was not cancelled")
+	}
+	if err := detached.Err(); err != nil {
+		t.Errorf("detached context Err() = %v after the parent was cancelled", err)
+	}
+	if detached.Done() != nil {
+		t.Error("detached context can be cancelled")
+	}
+	if _, ok := detached.Deadline(); ok {
+		t.Error("detached context kept the parent deadline")
+	}
+
+	if got := trace.SpanContextFromContext(detached); !got.Equal(span.SpanContext()) {
+		t.Errorf("detached span context = %v, want %v", got, span.SpanContext())
+	}
+	if trace.SpanFromContext(detached).IsRecording() {
+		t.Error("detached context carries the recording request span")
+	}
+	if got := Baggage(detached, "tenant.id"); got != "acme" {
+		t.Errorf("detached baggage tenant.id = %q, want acme", got)
+	}
+	if got := attributeMap(AttributesFromContext(detached)); got["tenant.id"] != "acme" {
+		t.Errorf("detached attributes = %v, want the request attributes", got)
+	}
+
+	// A context without a span stays without one.
+	if sc := trace.SpanContextFromContext(Detach(context.Background())); sc.IsValid() {
+		t.Errorf("Detach(Background) has span context %v", sc)
+	}
+}
+
+// waitForSpans waits until exporter holds n spans.
+func waitForSpans(t *testing.T, exporter *tracetest.InMemoryExporter, n int) tracetest.SpanStubs {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		spans := exporter.GetSpans()
+		if len(spans) >= n {
+			return spans
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d spans, want %d", len(spans), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGoDetached(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, parent := StartSpan(ctx, "request")
+
+	started := make(chan context.Context)
+	release := make(chan struct{})
+	errAudit := errors.New("audit store unavailable")
+	GoDetached(ctx, "audit", func(ctx context.Context) error {
+		started <- ctx
+		<-release
+		return errAudit
+	})
+	fnCtx := <-started
+
+	// The request ends before the detached work does.
+	parent.End()
+	cancel()
+	if err := fnCtx.Err(); err != nil {
+		t.Errorf("GoDetached context Err() = %v after the request was cancelled", err)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 1 {
+		t.Fatalf("got %d ended spans before fn returned, want only the request span", len(spans))
+	}
+
+	close(release)
+	child := waitForSpans(t, exporter, 2)[1]
+	if child.Name != "audit" {
+		t.Fatalf("span name = %q, want audit", child.Name)
+	}
+	if child.Parent.SpanID() != parent.SpanContext().SpanID() || child.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+		t.Error("detached span is not a child of the request span")
+	}
+	if got := trace.SpanContextFromContext(fnCtx); !got.Equal(child.SpanContext) {
+		t.Error("fn did not run under the detached span")
+	}
+	if child.Status.Code != codes.Error || child.Status.Description != errAudit.Error() {
+		t.Errorf("status = %v, want the error of fn", child.Status)
+	}
+}
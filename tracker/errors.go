@@ -0,0 +1,128 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	goErros "github.com/go-errors/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxErrorCauses bounds the number of exception events recorded for a single
+// error tree.
+const maxErrorCauses = 16
+
+// ErrorAttributer is implemented by errors that carry domain specific fields,
+// such as an error code or whether the operation can be retried. The
+// attributes are added to the exception event recorded by ErrorRecording.
+type ErrorAttributer interface {
+	ErrorAttributes() []attribute.KeyValue
+}
+
+// ErrorOption configures ErrorRecording.
+type ErrorOption func(*errorConfig)
+
+type errorConfig struct {
+	skipStatus bool
+	skipEvents bool
+	attributes []attribute.KeyValue
+}
+
+// WithStatusOnly makes ErrorRecording set the span status without adding
+// exception events.
+func WithStatusOnly() ErrorOption {
+	return func(c *errorConfig) {
+		c.skipEvents = true
+	}
+}
+
+// WithEventOnly makes ErrorRecording add exception events without marking
+// the span as failed, e.g. for errors that were handled.
+func WithEventOnly() ErrorOption {
+	return func(c *errorConfig) {
+		c.skipStatus = true
+	}
+}
+
+// WithErrorAttributes adds attributes to the exception event of the error.
+func WithErrorAttributes(attrs ...attribute.KeyValue) ErrorOption {
+	return func(c *errorConfig) {
+		c.attributes = append(c.attributes, attrs...)
+	}
+}
+
+// errorCauses flattens the tree of err into a list, depth first: err itself,
+// then each error it wraps with %w or joins with errors.Join.
+func errorCauses(err error) []error {
+	var causes []error
+	var walk func(error)
+	walk = func(err error) {
+		if err == nil || len(causes) >= maxErrorCauses {
+			return
+		}
+		causes = append(causes, err)
+		// A go-errors wrapper stands for the error it wraps, see errorType.
+		if e, ok := err.(*goErros.Error); ok && e.Err != nil {
+			err = e.Err
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				walk(e)
+			}
+		case interface{ Unwrap() error }:
+			walk(u.Unwrap())
+		}
+	}
+	walk(err)
+	return causes
+}
+
+// errorType returns the concrete type of err, looking through the go-errors
+// wrapper which otherwise hides it.
+func errorType(err error) string {
+	if e, ok := err.(*goErros.Error); ok && e.Err != nil {
+		return fmt.Sprintf("%T", e.Err)
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// errorStack returns the stack captured when err was created, if err carries
+// one: go-errors' Stack() []byte or pkg/errors' StackTrace().
+func errorStack(err error) (string, bool) {
+	if e, ok := err.(interface{ Stack() []byte }); ok {
+		return string(e.Stack()), true
+	}
+	// pkg/errors is matched by method name so it need not be a dependency;
+	// its StackTrace formats the frames with %+v.
+	if m := reflect.ValueOf(err).MethodByName("StackTrace"); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return fmt.Sprintf("%+v", m.Call(nil)[0].Interface()), true
+	}
+	return "", false
+}
+
+// creationStack looks for a stack carried by err or the errors it wraps.
+func creationStack(err error) (string, bool) {
+	for _, cause := range errorCauses(err) {
+		if stack, ok := errorStack(cause); ok {
+			return stack, true
+		}
+	}
+	return "", false
+}
+
+// errorAttributes returns the ErrorAttributes of err. With deep set it also
+// looks through the errors err wraps.
+func errorAttributes(err error, deep bool) []attribute.KeyValue {
+	if e, ok := err.(ErrorAttributer); ok {
+		return e.ErrorAttributes()
+	}
+	if deep {
+		var e ErrorAttributer
+		if errors.As(err, &e) {
+			return e.ErrorAttributes()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	goErros "github.com/go-errors/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// codedError carries domain attributes, like errors of an API client.
+type codedError struct{ code string }
+
+func (e *codedError) Error() string { return "code " + e.code }
+
+func (e *codedError) ErrorAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("error.code", e.code)}
+}
+
+// pkgStackTrace formats like pkg/errors' StackTrace, which is not a
+// dependency of the module.
+type pkgStackTrace []string
+
+func (s pkgStackTrace) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, strings.Join(s, "\n"))
+}
+
+// pkgError has the StackTrace method of the errors created by pkg/errors.
+type pkgError struct{ msg string }
+
+func (e *pkgError) Error() string { return e.msg }
+
+func (e *pkgError) StackTrace() pkgStackTrace {
+	return pkgStackTrace{"main.load", "\t/src/main.go:12"}
+}
+
+func errorMessages(errs []error) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
+func TestErrorCauses(t *testing.T) {
+	base := errors.New("connection refused")
+	wrapped := fmt.Errorf("query: %w", base)
+	joined := errors.Join(wrapped, os.ErrDeadlineExceeded)
+	var many []error
+	for i := 0; i < maxErrorCauses+4; i++ {
+		many = append(many, fmt.Errorf("e%d", i))
+	}
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{"single", base, []string{"connection refused"}},
+		{"wrapped", wrapped, []string{"query: connection refused", "connection refused"}},
+		{
+			"joined",
+			fmt.Errorf("save: %w", joined),
+			[]string{
+				"save: query: connection refused\ni/o timeout",
+				"query: connection refused\ni/o timeout",
+				"query: connection refused",
+				"connection refused",
+				"i/o timeout",
+			},
+		},
+		{
+			"go-errors wrapper",
+			goErros.Wrap(wrapped, 0),
+			[]string{"query: connection refused", "connection refused"},
+		},
+	}
+	for _, tt := range tests {
+		got := errorMessages(errorCauses(tt.err))
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: errorCauses() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	causes := errorCauses(errors.Join(many...))
+	if len(causes) != maxErrorCauses {
+		t.Fatalf("errorCauses() of %d joined errors returned %d causes, want %d", len(many), len(causes), maxErrorCauses)
+	}
+	if got := causes[maxErrorCauses-1].Error(); got != fmt.Sprintf("e%d", maxErrorCauses-2) {
+		t.Errorf("last cause = %q, want the causes in order", got)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&codedError{"E1"}, "*tracker.codedError"},
+		{goErros.Wrap(&codedError{"E1"}, 0), "*tracker.codedError"},
+		{goErros.New("plain"), "*errors.errorString"},
+		{fmt.Errorf("w: %w", os.ErrNotExist), "*fmt.wrapError"},
+	}
+	for _, tt := range tests {
+		if got := errorType(tt.err); got != tt.want {
+			t.Errorf("errorType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	goErr := goErros.New("boom")
+	if stack, ok := errorStack(goErr); !ok || stack != string(goErr.Stack()) {
+		t.Errorf("errorStack(go-errors) = %q, %v, want its Stack()", stack, ok)
+	}
+	if stack, ok := errorStack(&pkgError{"boom"}); !ok || stack != "main.load\n\t/src/main.go:12" {
+		t.Errorf("errorStack(pkg/errors) = %q, %v, want the formatted StackTrace()", stack, ok)
+	}
+	if _, ok := errorStack(errors.New("boom")); ok {
+		t.Error("errorStack() found a stack on an error without one")
+	}
+	if stack, ok := creationStack(fmt.Errorf("load: %w", &pkgError{"boom"})); !ok || !strings.HasPrefix(stack, "main.load") {
+		t.Errorf("creationStack() = %q, %v, want the stack of the wrapped error", stack, ok)
+	}
+}
+
+// recordError runs ErrorRecording on a new span and returns the ended span.
+func recordError(t *testing.T, err error, opts ...ErrorOption) sdktrace.ReadOnlySpan {
+	t.Helper()
+	exporter := withActiveConfig(t, &Config{})
+	ctx, span := StartSpan(context.Background(), "op")
+	ErrorRecording(ctx, err, opts...)
+	span.End()
+	return exporter.GetSpans().Snapshots()[0]
+}
+
+func eventAttributes(event sdktrace.Event) map[string]attribute.Value {
+	attrs := map[string]attribute.Value{}
+	for _, kv := range event.Attributes {
+		attrs[string(kv.Key)] = kv.Value
+	}
+	return attrs
+}
+
+func TestErrorRecording(t *testing.T) {
+	err := fmt.Errorf("charge: %w", &codedError{"card_declined"})
+	span := recordError(t, err, WithErrorAttributes(attribute.Bool("retryable", false)))
+
+	if span.Status().Code != codes.Error || span.Status().Description != err.Error() {
+		t.Errorf("status = %v, want an error with the message", span.Status())
+	}
+	events := span.Events()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want one for the error and one for its cause", len(events))
+	}
+	first := eventAttributes(events[0])
+	if first["exception.type"].AsString() != "*fmt.wrapError" || first["exception.message"].AsString() != err.Error() {
+		t.Errorf("first event = %v, want the outer error", first)
+	}
+	if first["error.code"].AsString() != "card_declined" {
+		t.Errorf("first event error.code = %q, want the ErrorAttributes of the cause", first["error.code"].AsString())
+	}
+	if _, ok := first["retryable"]; !ok {
+		t.Error("first event lacks the WithErrorAttributes attribute")
+	}
+	if first["exception.stacktrace"].AsString() == "" {
+		t.Error("first event lacks a stack trace")
+	}
+	if _, ok := first["exception.cause_index"]; ok {
+		t.Error("first event has exception.cause_index")
+	}
+	second := eventAttributes(events[1])
+	if second["exception.type"].AsString() != "*tracker.codedError" || second["exception.cause_index"].AsInt64() != 1 {
+		t.Errorf("second event = %v, want the cause at index 1", second)
+	}
+	if second["error.code"].AsString() != "card_declined" {
+		t.Error("second event lacks the ErrorAttributes of the cause")
+	}
+	if _, ok := second["retryable"]; ok {
+		t.Error("WithErrorAttributes attribute was added to a cause")
+	}
+}
+
+func TestErrorRecordingCreationStack(t *testing.T) {
+	span := recordError(t, fmt.Errorf("load: %w", &pkgError{"boom"}))
+	if got := eventAttributes(span.Events()[0])["exception.stacktrace"].AsString(); got != "main.load\n\t/src/main.go:12" {
+		t.Errorf("exception.stacktrace = %q, want the stack the error was created with", got)
+	}
+}
+
+func TestErrorRecordingOptions(t *testing.T) {
+	err := errors.New("not found")
+	span := recordError(t, err, WithStatusOnly())
+	if len(span.Events()) != 0 || span.Status().Code != codes.Error {
+		t.Errorf("WithStatusOnly: got %d events and status %v, want no events and an error", len(span.Events()), span.Status())
+	}
+	span = recordError(t, err, WithEventOnly())
+	if len(span.Events()) != 1 || span.Status().Code != codes.Unset {
+		t.Errorf("WithEventOnly: got %d events and status %v, want one event and no status", len(span.Events()), span.Status())
+	}
+	span = recordError(t, nil)
+	if len(span.Events()) != 0 || span.Status().Code != codes.Unset {
+		t.Error("ErrorRecording(nil) changed the span")
+	}
+}
@@ -1,89 +1,160 @@
 package tracker
 
 import (
-	"os"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
 
-	gogit "github.com/go-git/go-git/v5"
 	"go.opentelemetry.io/otel/attribute"
 )
 
-func addVCSAttributes(attributes []attribute.KeyValue) []attribute.KeyValue {
-	// Read MW_VCS_REPOSITORY_URL and MW_VCS_COMMIT_SHA environment variables
-	vcsRepositoryURL := os.Getenv("MW_VCS_REPOSITORY_URL")
-	vcsCommitSHA := os.Getenv("MW_VCS_COMMIT_SHA")
+// vcsInfo describes the source revision the binary was built from.
+type vcsInfo struct {
+	repositoryURL string
+	commitSHA     string
+	commitTime    string
+	branch        string
+	tag           string
+	// moduleVersion is the main module version recorded by the Go toolchain.
+	moduleVersion string
+	dirty         bool
+	dirtyKnown    bool
+}
 
-	// If missing, try to get from .git using go-git (pure Go, no git CLI needed)
-	if vcsRepositoryURL == "" || vcsCommitSHA == "" {
-		gitDir := findGitDir()
-		if gitDir != "" {
-			repo, err := gogit.PlainOpen(gitDir)
-			if err == nil {
-				if vcsCommitSHA == "" {
-					head, err := repo.Head()
-					if err == nil {
-						vcsCommitSHA = head.Hash().String()
-					}
-				}
-				if vcsRepositoryURL == "" {
-					remotes, err := repo.Remotes()
-					if err == nil && len(remotes) > 0 {
-						urls := remotes[0].Config().URLs
-						if len(urls) > 0 {
-							vcsRepositoryURL = urls[0]
-							// Remove .git suffix if present
-							if len(vcsRepositoryURL) > 4 && vcsRepositoryURL[len(vcsRepositoryURL)-4:] == ".git" {
-								vcsRepositoryURL = vcsRepositoryURL[:len(vcsRepositoryURL)-4]
-							}
-						}
-					}
-				}
-			}
-		}
+// gitVCSFallback fills in what build info could not provide by reading the
+// .git directory. It is only set when built with the mwgit build tag, which
+// keeps go-git out of regular builds.
+var gitVCSFallback func(info *vcsInfo)
+
+// pseudoVersionPattern matches the timestamp and revision suffix of Go
+// pseudo-versions such as v0.0.0-20240102150405-abcdef123456.
+var pseudoVersionPattern = regexp.MustCompile(`\d{14}-[0-9a-f]{12}$`)
+
+// detectVCS collects VCS information from, in order of precedence, the
+// MW_VCS_* environment variables, the build info stamped by `go build`,
+// well-known CI variables and, with the mwgit build tag, the .git directory.
+func detectVCS(getenv func(string) string) vcsInfo {
+	bi, _ := debug.ReadBuildInfo()
+	info := resolveVCS(getenv, bi)
+	if gitVCSFallback != nil && (info.commitSHA == "" || info.repositoryURL == "" || info.branch == "") {
+		gitVCSFallback(&info)
 	}
+	info.repositoryURL = strings.TrimSuffix(info.repositoryURL, ".git")
+	return info
+}
 
-	// Add their values as resource attributes
-	if vcsRepositoryURL != "" {
-		attributes = append(attributes, attribute.String("vcs.repository_url", vcsRepositoryURL))
+// resolveVCS combines the environment read through getenv with the build
+// info bi, which may be nil.
+func resolveVCS(getenv func(string) string, bi *debug.BuildInfo) vcsInfo {
+	info := vcsInfo{
+		repositoryURL: getenv("MW_VCS_REPOSITORY_URL"),
+		commitSHA:     getenv("MW_VCS_COMMIT_SHA"),
+		branch:        getenv("MW_VCS_BRANCH"),
+		tag:           getenv("MW_VCS_TAG"),
+	}
+	if bi != nil {
+		applyBuildInfo(&info, bi)
 	}
-	if vcsCommitSHA != "" {
-		attributes = append(attributes, attribute.String("vcs.commit_sha", vcsCommitSHA))
+	if info.branch == "" {
+		info.branch = ciBranch(getenv)
 	}
+	if info.tag == "" {
+		info.tag = ciTag(getenv)
+	}
+	return info
+}
 
-	return attributes
+// applyBuildInfo fills the fields of info that are still empty from the
+// vcs.* settings and main module of bi.
+func applyBuildInfo(info *vcsInfo, bi *debug.BuildInfo) {
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.commitSHA == "" {
+				info.commitSHA = s.Value
+			}
+		case "vcs.time":
+			info.commitTime = s.Value
+		case "vcs.modified":
+			if modified, err := strconv.ParseBool(s.Value); err == nil {
+				info.dirty, info.dirtyKnown = modified, true
+			}
+		}
+	}
+	if v := bi.Main.Version; v != "" && v != "(devel)" {
+		info.moduleVersion = v
+		// Release builds of a tagged module carry the tag as version.
+		if info.tag == "" && !pseudoVersionPattern.MatchString(strings.TrimSuffix(v, "+dirty")) {
+			info.tag = strings.TrimSuffix(v, "+dirty")
+		}
+	}
+	if info.repositoryURL == "" {
+		info.repositoryURL = repositoryURLFromModule(bi.Main.Path)
+	}
 }
 
-// Helper to find .git directory in current or parent directories
-func findGitDir() string {
-	dir, err := os.Getwd()
-	if err != nil {
+// repositoryURLFromModule derives the repository URL from module paths
+// hosted on well-known forges, e.g. github.com/org/repo/v2.
+func repositoryURLFromModule(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
 		return ""
 	}
-	for {
-		gitPath := dir + "/.git"
-		if stat, err := os.Stat(gitPath); err == nil && stat.IsDir() {
-			return dir
-		}
-		parent := parentDir(dir)
-		if parent == dir {
-			break
-		}
-		dir = parent
+	switch parts[0] {
+	case "github.com", "gitlab.com", "bitbucket.org":
+		return "https://" + strings.Join(parts[:3], "/")
 	}
 	return ""
 }
 
-// Helper to get parent directory
-func parentDir(path string) string {
-	if len(path) == 0 {
+func ciBranch(getenv func(string) string) string {
+	if getenv("GITHUB_ACTIONS") != "" {
+		if ref := getenv("GITHUB_HEAD_REF"); ref != "" {
+			return ref
+		}
+		if getenv("GITHUB_REF_TYPE") == "branch" {
+			return getenv("GITHUB_REF_NAME")
+		}
 		return ""
 	}
-	for i := len(path) - 1; i >= 0; i-- {
-		if path[i] == '/' {
-			if i == 0 {
-				return "/"
-			}
-			return path[:i]
+	branch := firstEnv(getenv, []string{"CI_COMMIT_BRANCH", "BUILDKITE_BRANCH", "CIRCLE_BRANCH", "BRANCH_NAME", "GIT_BRANCH"})
+	return strings.TrimPrefix(branch, "origin/")
+}
+
+func ciTag(getenv func(string) string) string {
+	if getenv("GITHUB_ACTIONS") != "" {
+		if getenv("GITHUB_REF_TYPE") == "tag" {
+			return getenv("GITHUB_REF_NAME")
 		}
+		return ""
 	}
-	return path
+	return firstEnv(getenv, []string{"CI_COMMIT_TAG", "BUILDKITE_TAG", "CIRCLE_TAG", "TAG_NAME"})
+}
+
+// addVCSAttributes adds the detected VCS information and service version to
+// the resource attributes.
+func addVCSAttributes(attributes []attribute.KeyValue, c *Config) []attribute.KeyValue {
+	if c.ServiceVersion != "" {
+		attributes = append(attributes, attribute.String("service.version", c.ServiceVersion))
+	}
+	if c.vcs.repositoryURL != "" {
+		attributes = append(attributes, attribute.String("vcs.repository_url", c.vcs.repositoryURL))
+	}
+	if c.vcs.commitSHA != "" {
+		attributes = append(attributes, attribute.String("vcs.commit_sha", c.vcs.commitSHA))
+	}
+	if c.vcs.commitTime != "" {
+		attributes = append(attributes, attribute.String("vcs.commit_time", c.vcs.commitTime))
+	}
+	if c.vcs.branch != "" {
+		attributes = append(attributes, attribute.String("vcs.branch", c.vcs.branch))
+	}
+	if c.vcs.tag != "" {
+		attributes = append(attributes, attribute.String("vcs.tag", c.vcs.tag))
+	}
+	if c.vcs.dirtyKnown {
+		attributes = append(attributes, attribute.Bool("vcs.dirty", c.vcs.dirty))
+	}
+	return attributes
 }
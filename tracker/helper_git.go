@@ -0,0 +1,90 @@
+//go:build mwgit
+
+package tracker
+
+import (
+	"os"
+	"path/filepath"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+func init() {
+	gitVCSFallback = readGitVCS
+}
+
+// readGitVCS fills missing VCS fields from the .git directory found in the
+// working directory or one of its parents.
+func readGitVCS(info *vcsInfo) {
+	gitDir := findGitDir()
+	if gitDir == "" {
+		return
+	}
+	repo, err := gogit.PlainOpen(gitDir)
+	if err != nil {
+		return
+	}
+
+	head, err := repo.Head()
+	if err == nil {
+		if info.commitSHA == "" {
+			info.commitSHA = head.Hash().String()
+		}
+		if info.branch == "" && head.Name().IsBranch() {
+			info.branch = head.Name().Short()
+		}
+		if info.tag == "" {
+			info.tag = tagAt(repo, head.Hash())
+		}
+	}
+
+	if info.repositoryURL == "" {
+		remotes, err := repo.Remotes()
+		if err == nil && len(remotes) > 0 {
+			if urls := remotes[0].Config().URLs; len(urls) > 0 {
+				info.repositoryURL = urls[0]
+			}
+		}
+	}
+}
+
+// tagAt returns the name of a tag pointing at hash, lightweight or annotated.
+func tagAt(repo *gogit.Repository, hash plumbing.Hash) string {
+	tags, err := repo.Tags()
+	if err != nil {
+		return ""
+	}
+	var name string
+	_ = tags.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		if tag, err := repo.TagObject(target); err == nil {
+			target = tag.Target
+		}
+		if target == hash {
+			name = ref.Name().Short()
+			return storer.ErrStop
+		}
+		return nil
+	})
+	return name
+}
+
+// findGitDir looks for a .git directory in the current or parent directories.
+func findGitDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if stat, err := os.Stat(filepath.Join(dir, ".git")); err == nil && stat.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
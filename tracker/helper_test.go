@@ -0,0 +1,163 @@
+package tracker
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestResolveVCS(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs", Value: "git"},
+		{Key: "vcs.revision", Value: "4f2a9c1"},
+		{Key: "vcs.time", Value: "2024-05-01T12:00:00Z"},
+		{Key: "vcs.modified", Value: "true"},
+	}
+	tests := []struct {
+		name string
+		env  map[string]string
+		bi   *debug.BuildInfo
+		want vcsInfo
+	}{
+		{
+			name: "tagged release",
+			bi: &debug.BuildInfo{
+				Main:     debug.Module{Path: "github.com/acme/shop/v2", Version: "v2.3.0"},
+				Settings: settings,
+			},
+			want: vcsInfo{
+				repositoryURL: "https://github.com/acme/shop",
+				commitSHA:     "4f2a9c1",
+				commitTime:    "2024-05-01T12:00:00Z",
+				tag:           "v2.3.0",
+				moduleVersion: "v2.3.0",
+				dirty:         true,
+				dirtyKnown:    true,
+			},
+		},
+		{
+			name: "dirty release",
+			bi:   &debug.BuildInfo{Main: debug.Module{Path: "example.com/shop", Version: "v1.4.2+dirty"}},
+			want: vcsInfo{tag: "v1.4.2", moduleVersion: "v1.4.2+dirty"},
+		},
+		{
+			name: "pseudo-version",
+			bi:   &debug.BuildInfo{Main: debug.Module{Path: "gitlab.com/acme/shop", Version: "v0.0.0-20240501120000-4f2a9c1d2e3f"}},
+			want: vcsInfo{repositoryURL: "https://gitlab.com/acme/shop", moduleVersion: "v0.0.0-20240501120000-4f2a9c1d2e3f"},
+		},
+		{
+			name: "devel build",
+			bi: &debug.BuildInfo{
+				Main:     debug.Module{Path: "shop", Version: "(devel)"},
+				Settings: []debug.BuildSetting{{Key: "vcs.modified", Value: "unknown"}},
+			},
+		},
+		{
+			name: "environment overrides",
+			env: map[string]string{
+				"MW_VCS_REPOSITORY_URL": "https://git.example.com/shop",
+				"MW_VCS_COMMIT_SHA":     "e0c1d2",
+				"MW_VCS_BRANCH":         "release",
+				"MW_VCS_TAG":            "v9",
+				"GITHUB_ACTIONS":        "true",
+				"GITHUB_HEAD_REF":       "feature",
+			},
+			bi: &debug.BuildInfo{
+				Main:     debug.Module{Path: "github.com/acme/shop", Version: "v2.3.0"},
+				Settings: settings,
+			},
+			want: vcsInfo{
+				repositoryURL: "https://git.example.com/shop",
+				commitSHA:     "e0c1d2",
+				commitTime:    "2024-05-01T12:00:00Z",
+				branch:        "release",
+				tag:           "v9",
+				moduleVersion: "v2.3.0",
+				dirty:         true,
+				dirtyKnown:    true,
+			},
+		},
+		{
+			name: "no build info",
+			env:  map[string]string{"CI_COMMIT_BRANCH": "main", "CI_COMMIT_TAG": "v1.0.0"},
+			want: vcsInfo{branch: "main", tag: "v1.0.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveVCS(mapGetenv(tt.env), tt.bi); got != tt.want {
+				t.Errorf("resolveVCS() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCIBranchAndTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		branch, tag string
+	}{
+		{
+			name:   "GitHub pull request",
+			env:    map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_HEAD_REF": "fix-login", "GITHUB_REF_TYPE": "branch", "GITHUB_REF_NAME": "42/merge"},
+			branch: "fix-login",
+		},
+		{
+			name:   "GitHub push",
+			env:    map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF_TYPE": "branch", "GITHUB_REF_NAME": "main"},
+			branch: "main",
+		},
+		{
+			name: "GitHub tag",
+			env:  map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF_TYPE": "tag", "GITHUB_REF_NAME": "v1.2.0", "GIT_BRANCH": "main"},
+			tag:  "v1.2.0",
+		},
+		{
+			name:   "GitLab",
+			env:    map[string]string{"CI_COMMIT_BRANCH": "develop"},
+			branch: "develop",
+		},
+		{
+			name: "Buildkite tag",
+			env:  map[string]string{"BUILDKITE_BRANCH": "v2.0.0", "BUILDKITE_TAG": "v2.0.0"},
+			// Buildkite reports the tag as branch of tag builds.
+			branch: "v2.0.0",
+			tag:    "v2.0.0",
+		},
+		{
+			name:   "Jenkins",
+			env:    map[string]string{"GIT_BRANCH": "origin/main"},
+			branch: "main",
+		},
+		{
+			name: "no CI",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := mapGetenv(tt.env)
+			if got := ciBranch(getenv); got != tt.branch {
+				t.Errorf("ciBranch() = %q, want %q", got, tt.branch)
+			}
+			if got := ciTag(getenv); got != tt.tag {
+				t.Errorf("ciTag() = %q, want %q", got, tt.tag)
+			}
+		})
+	}
+}
+
+func TestRepositoryURLFromModule(t *testing.T) {
+	tests := map[string]string{
+		"github.com/acme/shop":        "https://github.com/acme/shop",
+		"github.com/acme/shop/v2/cmd": "https://github.com/acme/shop",
+		"bitbucket.org/acme/shop":     "https://bitbucket.org/acme/shop",
+		"github.com/acme":             "",
+		"example.com/acme/shop":       "",
+		"command-line-arguments":      "",
+	}
+	for path, want := range tests {
+		if got := repositoryURLFromModule(path); got != want {
+			t.Errorf("repositoryURLFromModule(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
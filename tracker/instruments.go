@@ -0,0 +1,80 @@
+package tracker
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ActiveMeterProvider returns the provider installed by Track, or the global one
+// until metrics are initialised in the background. Instrumentation that
+// caches instruments should check it again rather than keep the first one.
+func ActiveMeterProvider() metric.MeterProvider {
+	if mp := activeMeterProvider.Load(); mp != nil {
+		return mp
+	}
+	return otel.GetMeterProvider()
+}
+
+// Meter returns the tracker's meter.
+func Meter() metric.Meter {
+	return ActiveMeterProvider().Meter(instrumentationName, metric.WithInstrumentationVersion(instrumentationVersion()))
+}
+
+// MetricAttributes returns a measurement option with attrs and the
+// attributes attached to ctx with WithAttributes, for instruments created
+// from Meter. Keep context attributes low-cardinality when used on metrics.
+func MetricAttributes(ctx context.Context, attrs ...attribute.KeyValue) metric.MeasurementOption {
+	ctxAttrs := AttributesFromContext(ctx)
+	if len(ctxAttrs) == 0 {
+		return metric.WithAttributes(attrs...)
+	}
+	return metric.WithAttributes(append(ctxAttrs, attrs...)...)
+}
+
+// instrumentKey identifies a cached instrument. The provider is part of the
+// key so that instruments created before metrics were initialised are
+// replaced afterwards.
+type instrumentKey struct {
+	provider metric.MeterProvider
+	name     string
+}
+
+var (
+	counters   sync.Map // instrumentKey -> metric.Int64Counter
+	histograms sync.Map // instrumentKey -> metric.Float64Histogram
+)
+
+// Count adds incr to the counter called name, with attrs and the attributes
+// attached to ctx.
+func Count(ctx context.Context, name string, incr int64, attrs ...attribute.KeyValue) {
+	key := instrumentKey{ActiveMeterProvider(), name}
+	c, ok := counters.Load(key)
+	if !ok {
+		counter, err := Meter().Int64Counter(name)
+		if err != nil {
+			log.Println("failed to create counter: ", err)
+		}
+		c, _ = counters.LoadOrStore(key, counter)
+	}
+	c.(metric.Int64Counter).Add(ctx, incr, MetricAttributes(ctx, attrs...))
+}
+
+// Record records value in the histogram called name, with attrs and the
+// attributes attached to ctx.
+func Record(ctx context.Context, name string, value float64, attrs ...attribute.KeyValue) {
+	key := instrumentKey{ActiveMeterProvider(), name}
+	h, ok := histograms.Load(key)
+	if !ok {
+		histogram, err := Meter().Float64Histogram(name)
+		if err != nil {
+			log.Println("failed to create histogram: ", err)
+		}
+		h, _ = histograms.LoadOrStore(key, histogram)
+	}
+	h.(metric.Float64Histogram).Record(ctx, value, MetricAttributes(ctx, attrs...))
+}
@@ -3,17 +3,12 @@ package tracker
 import (
 	"net/url"
 	"context"
-	"fmt"
 	"log"
 	"os"
-	"strings"
 
-	"go.opentelemetry.io/contrib/propagators/b3"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
-	"go.opentelemetry.io/otel/propagation"
 	otellog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/resource"
 )
@@ -69,53 +64,17 @@ func (t *Logs) initLogs(ctx context.Context, c *Config) error {
 		attribute.String("mw_serverless", c.isServerless),
 	}
 
-	for key, value := range c.customResourceAttributes {
-		switch v := value.(type) {
-		case string:
-			attributes = append(attributes, attribute.String(key, v))
-		case bool:
-			attributes = append(attributes, attribute.Bool(key, v))
-		case int:
-			attributes = append(attributes, attribute.Int(key, v)) // handle int
-		case int64:
-			attributes = append(attributes, attribute.Int64(key, v)) // handle int64
-		case float64:
-			attributes = append(attributes, attribute.Float64(key, v)) // handle float64
-		case float32:
-			attributes = append(attributes, attribute.Float64(key, float64(v))) // cast float32 to float64
-		case []string:
-			for _, s := range v {
-				attributes = append(attributes, attribute.String(key, s)) // handle []string by appending each string
-			}
-		case []int:
-			for _, i := range v {
-				attributes = append(attributes, attribute.Int(key, i)) // handle []int by appending each int
-			}
-		case []float64:
-			for _, f := range v {
-				attributes = append(attributes, attribute.Float64(key, f)) // handle []float64 by appending each float64
-			}
-		default:
-			fmt.Printf("Unsupported attribute type for key: %s\n", key)
-		}
-	}
+	// Adding custom resource attributes from the config and MW_CUSTOM_RESOURCE_ATTRIBUTES
+	attributes = addCustomResourceAttributes(attributes, c)
 
-	// Get the MW_CUSTOM_RESOURCE_ATTRIBUTES environment variable
-	envResourceAttributes := os.Getenv("MW_CUSTOM_RESOURCE_ATTRIBUTES")
-	// Split the attributes by comma
-	attrs := strings.Split(envResourceAttributes, ",")
-	for _, attr := range attrs {
-		// Split each attribute by the '=' character
-		kv := strings.SplitN(attr, "=", 2)
-		if len(kv) == 2 {
-			key := strings.TrimSpace(kv[0])
-			value := strings.TrimSpace(kv[1])
-			attributes = append(attributes, attribute.String(key, value))
-		}
-	}
+	// Adding VCS information and service version to the resource attributes
+	attributes = addVCSAttributes(attributes, c)
 
-	// Adding VCS information to the resource attributes
-	attributes = addVCSAttributes(attributes)
+	// Adding container and Kubernetes information to the resource attributes
+	attributes = addContainerAttributes(attributes, c)
+
+	// Adding cloud platform information to the resource attributes
+	attributes = addCloudAttributes(attributes, c)
 
 	resources, err := resource.New(
 		context.Background(),
@@ -128,28 +87,21 @@ func (t *Logs) initLogs(ctx context.Context, c *Config) error {
 		log.Println("failed to set resources for logs:", err)
 	}
 
+	providerOptions := []otellog.LoggerProviderOption{
+		otellog.WithResource(resources),
+		// Processors that enrich records must come before the exporting ones.
+		otellog.WithProcessor(ContextAttributesLogProcessor{}),
+	}
+	if len(c.baggageKeys) > 0 {
+		providerOptions = append(providerOptions, otellog.WithProcessor(NewBaggageLogProcessor(c.baggageKeys...)))
+	}
 	if c.debug {
-		LogProvider = *otellog.NewLoggerProvider(
-			otellog.WithResource(resources),
-			otellog.WithProcessor(otellog.NewBatchProcessor(consoleExporter)),
-			otellog.WithProcessor(otellog.NewBatchProcessor(exp)),
-		)
-	} else {
-		LogProvider = *otellog.NewLoggerProvider(
-			otellog.WithResource(resources),
-			otellog.WithProcessor(otellog.NewBatchProcessor(exp)),
-		)
+		providerOptions = append(providerOptions, otellog.WithProcessor(newSeverityFilter(c.logLevel, otellog.NewBatchProcessor(consoleExporter))))
 	}
+	providerOptions = append(providerOptions, otellog.WithProcessor(newSeverityFilter(c.logLevel, otellog.NewBatchProcessor(exp))))
+	LogProvider = *otellog.NewLoggerProvider(providerOptions...)
 
 	c.Lp = &LogProvider
 
-	p := b3.New()
-	otel.SetTextMapPropagator(
-		propagation.NewCompositeTextMapPropagator(
-			p,
-			propagation.TraceContext{},
-			propagation.Baggage{}),
-	)
-
 	return err
 }
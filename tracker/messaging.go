@@ -0,0 +1,204 @@
+package tracker
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header is a message header with a binary value, as used by Kafka and
+// similar clients. A *[]Header can be passed to Inject and Extract.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// HeaderCarrier is implemented by message types that carry string headers.
+// If it also has a Keys() []string method, propagators that enumerate
+// headers, such as Jaeger baggage, can use it.
+type HeaderCarrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// Inject writes the span context and baggage of ctx into carrier using the
+// configured propagators. carrier is a map[string]string, a *[]Header, an
+// http.Header or a HeaderCarrier. A []Header value cannot be appended to in
+// place, so it is rejected with a log message.
+func Inject(ctx context.Context, carrier any) {
+	if _, ok := carrier.([]Header); ok {
+		log.Println("tracker.Inject: pass a *[]Header, a []Header cannot be written to")
+		return
+	}
+	if c := textMapCarrier(carrier); c != nil {
+		ActivePropagator().Inject(ctx, c)
+	}
+}
+
+// Extract returns a copy of ctx with the span context and baggage read from
+// carrier, which is one of the types accepted by Inject or a []Header.
+func Extract(ctx context.Context, carrier any) context.Context {
+	if c := textMapCarrier(carrier); c != nil {
+		return ActivePropagator().Extract(ctx, c)
+	}
+	return ctx
+}
+
+func textMapCarrier(carrier any) propagation.TextMapCarrier {
+	switch c := carrier.(type) {
+	case propagation.TextMapCarrier:
+		return c
+	case map[string]string:
+		return propagation.MapCarrier(c)
+	case http.Header:
+		return propagation.HeaderCarrier(c)
+	case *[]Header:
+		return (*headersCarrier)(c)
+	case []Header:
+		// Only read by Extract, so the local copy is never appended to.
+		return (*headersCarrier)(&c)
+	case HeaderCarrier:
+		return headerCarrierAdapter{c}
+	case nil:
+		return nil
+	}
+	log.Printf("unsupported propagation carrier: %T\n", carrier)
+	return nil
+}
+
+// headersCarrier adapts a header slice. Set replaces an existing header
+// with the same key.
+type headersCarrier []Header
+
+func (h *headersCarrier) Get(key string) string {
+	for _, header := range *h {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h *headersCarrier) Set(key, value string) {
+	for i, header := range *h {
+		if header.Key == key {
+			(*h)[i].Value = []byte(value)
+			return
+		}
+	}
+	*h = append(*h, Header{Key: key, Value: []byte(value)})
+}
+
+func (h *headersCarrier) Keys() []string {
+	keys := make([]string, len(*h))
+	for i, header := range *h {
+		keys[i] = header.Key
+	}
+	return keys
+}
+
+type headerCarrierAdapter struct {
+	HeaderCarrier
+}
+
+func (a headerCarrierAdapter) Keys() []string {
+	if k, ok := a.HeaderCarrier.(interface{ Keys() []string }); ok {
+		return k.Keys()
+	}
+	return nil
+}
+
+// messagingAttributes returns the messaging semantic convention attributes
+// shared by producer and consumer spans.
+func messagingAttributes(system, destination, operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", destination),
+		attribute.String("messaging.operation.type", operation),
+	}
+}
+
+// StartProducerSpan starts a producer span named "publish <destination>" and
+// injects its context into carrier, the headers of the outgoing message.
+// system is the messaging system, e.g. "kafka" or "rabbitmq". The caller must
+// End the returned span once the message is sent.
+func StartProducerSpan(ctx context.Context, system, destination string, carrier any, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttributes(system, destination, "publish")...),
+	)
+	ctx, span := startSpan(ctx, "publish "+destination, 1, opts)
+	Inject(ctx, carrier)
+	return ctx, span
+}
+
+// StartConsumerSpan starts a consumer span named "process <destination>" for
+// a single message, as a child of the producer context extracted from
+// carrier. The caller must End the returned span once the message is
+// handled.
+func StartConsumerSpan(ctx context.Context, system, destination string, carrier any, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx = Extract(ctx, carrier)
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(system, destination, "process")...),
+	)
+	return startSpan(ctx, "process "+destination, 1, opts)
+}
+
+// StartReceiveSpan starts a consumer span named "receive <destination>" for
+// pulling a message. The span stays a child of the span in ctx; link it to the
+// producer span with AddProducerLink once the message has arrived. The caller
+// must End the returned span once the message is received.
+func StartReceiveSpan(ctx context.Context, system, destination string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(system, destination, "receive")...),
+	)
+	return startSpan(ctx, "receive "+destination, 1, opts)
+}
+
+// AddProducerLink links span to the producer context read from carrier, the
+// headers of a received message.
+func AddProducerLink(span trace.Span, carrier any) {
+	sc := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+	if sc.IsValid() {
+		span.AddLink(trace.Link{SpanContext: sc})
+	}
+}
+
+// StartBatchConsumerSpan starts one consumer span named
+// "process <destination>" for a batch of messages. The span stays a child of
+// the span in ctx and is linked to the producer context of every message,
+// read from carriers. destination is empty for a batch read from several
+// destinations; the span is then named "process" and has no
+// messaging.destination.name. The caller must End the returned span once the
+// batch is handled.
+func StartBatchConsumerSpan[C any](ctx context.Context, system, destination string, carriers []C, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(carriers))
+	for _, carrier := range carriers {
+		sc := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	name := "process"
+	attributes := []attribute.KeyValue{
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.operation.type", "process"),
+		attribute.Int("messaging.batch.message_count", len(carriers)),
+	}
+	if destination != "" {
+		name += " " + destination
+		attributes = append(attributes, attribute.String("messaging.destination.name", destination))
+	}
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attributes...),
+	)
+	return startSpan(ctx, name, 1, opts)
+}
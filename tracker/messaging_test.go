@@ -0,0 +1,38 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtractHeaders(t *testing.T) {
+	activeConfig.Store(&Config{propagator: propagation.TraceContext{}})
+	defer activeConfig.Store(nil)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	var headers []Header
+	Inject(ctx, headers)
+	if len(headers) != 0 {
+		t.Fatalf("Inject wrote into a []Header value: %v", headers)
+	}
+	Inject(ctx, &headers)
+	if len(headers) != 1 || headers[0].Key != "traceparent" {
+		t.Fatalf("Inject(*[]Header) = %v, want a traceparent header", headers)
+	}
+
+	for _, carrier := range []any{headers, &headers} {
+		got := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+		if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() {
+			t.Errorf("Extract(%T) = %v, want %v", carrier, got, sc)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
-	"strings"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -65,53 +64,17 @@ func (t *Metrics) initMetrics(ctx context.Context, c *Config) error {
 		attribute.String("mw_serverless", c.isServerless),
 	}
 
-	for key, value := range c.customResourceAttributes {
-		switch v := value.(type) {
-		case string:
-			attributes = append(attributes, attribute.String(key, v))
-		case bool:
-			attributes = append(attributes, attribute.Bool(key, v))
-		case int:
-			attributes = append(attributes, attribute.Int(key, v)) // handle int
-		case int64:
-			attributes = append(attributes, attribute.Int64(key, v)) // handle int64
-		case float64:
-			attributes = append(attributes, attribute.Float64(key, v)) // handle float64
-		case float32:
-			attributes = append(attributes, attribute.Float64(key, float64(v))) // cast float32 to float64
-		case []string:
-			for _, s := range v {
-				attributes = append(attributes, attribute.String(key, s)) // handle []string by appending each string
-			}
-		case []int:
-			for _, i := range v {
-				attributes = append(attributes, attribute.Int(key, i)) // handle []int by appending each int
-			}
-		case []float64:
-			for _, f := range v {
-				attributes = append(attributes, attribute.Float64(key, f)) // handle []float64 by appending each float64
-			}
-		default:
-			log.Printf("Unsupported attribute type for key: %s\n", key)
-		}
-	}
+	// Adding custom resource attributes from the config and MW_CUSTOM_RESOURCE_ATTRIBUTES
+	attributes = addCustomResourceAttributes(attributes, c)
 
-	// Get the MW_CUSTOM_RESOURCE_ATTRIBUTES environment variable
-	envResourceAttributes := os.Getenv("MW_CUSTOM_RESOURCE_ATTRIBUTES")
-	// Split the attributes by comma
-	attrs := strings.Split(envResourceAttributes, ",")
-	for _, attr := range attrs {
-		// Split each attribute by the '=' character
-		kv := strings.SplitN(attr, "=", 2)
-		if len(kv) == 2 {
-			key := strings.TrimSpace(kv[0])
-			value := strings.TrimSpace(kv[1])
-			attributes = append(attributes, attribute.String(key, value))
-		}
-	}
+	// Adding VCS information and service version to the resource attributes
+	attributes = addVCSAttributes(attributes, c)
+
+	// Adding container and Kubernetes information to the resource attributes
+	attributes = addContainerAttributes(attributes, c)
 
-	// Adding VCS information to the resource attributes
-	attributes = addVCSAttributes(attributes)
+	// Adding cloud platform information to the resource attributes
+	attributes = addCloudAttributes(attributes, c)
 
 	resources, err := resource.New(
 		context.Background(),
@@ -135,6 +98,7 @@ func (t *Metrics) initMetrics(ctx context.Context, c *Config) error {
 	}
 
 	c.Mp = &MeterProvider
+	activeMeterProvider.Store(c.Mp)
 	
 	if otel.GetMeterProvider() == nil {
         otel.SetMeterProvider(c.Mp)
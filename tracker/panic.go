@@ -0,0 +1,174 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// panicFlushTimeout bounds how long a crashing process waits for telemetry
+// to be exported.
+const panicFlushTimeout = 5 * time.Second
+
+// activeMeterProvider is set once metrics are initialised, which happens in
+// the background.
+var activeMeterProvider atomic.Pointer[sdkmetric.MeterProvider]
+
+// RecoverAndReport reports a panic of the calling goroutine to Middleware and
+// re-panics. It must be deferred directly:
+//
+//	defer tracker.RecoverAndReport(ctx)
+//
+// The panic value and stack are recorded as an exception event on the span in
+// ctx, which is then ended, or on a new "panic" span when ctx has none. An
+// error log record is emitted and all providers are flushed, waiting at most
+// five seconds, before the panic continues. A panic unwinding through nested
+// Trace and RecoverAndReport calls is recorded, logged and flushed once.
+func RecoverAndReport(ctx context.Context) {
+	if r := recover(); r != nil {
+		reportPanic(ctx, r, debug.Stack())
+		panic(r)
+	}
+}
+
+// Go runs fn in a new goroutine, reporting a panic in it like
+// RecoverAndReport.
+func Go(ctx context.Context, fn func(ctx context.Context)) {
+	go func() {
+		defer RecoverAndReport(ctx)
+		fn(ctx)
+	}()
+}
+
+func reportPanic(ctx context.Context, r any, stack []byte) {
+	state := panicStateFor(r)
+	if !state.reported.CompareAndSwap(false, true) {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if state.recorded.CompareAndSwap(false, true) {
+		if !span.IsRecording() {
+			ctx, span = StartSpan(ctx, "panic")
+		}
+		recordPanic(span, r, stack)
+		// The process is about to die, so end the span now or it is never
+		// exported. A later End by the caller is a no-op.
+		span.End()
+	} else if span.IsRecording() {
+		// An inner Trace already added the exception event.
+		span.SetStatus(codes.Error, fmt.Sprintf("panic: %v", r))
+		span.End()
+	}
+
+	c := activeConfig.Load()
+	if c != nil && c.Lp != nil {
+		var record otellog.Record
+		record.SetTimestamp(time.Now())
+		record.SetSeverity(otellog.SeverityError)
+		record.SetSeverityText("ERROR")
+		record.SetBody(otellog.StringValue(fmt.Sprintf("panic: %v", r)))
+		record.AddAttributes(
+			otellog.String("exception.type", fmt.Sprintf("%T", r)),
+			otellog.String("exception.message", fmt.Sprint(r)),
+			otellog.String("exception.stacktrace", string(stack)),
+			otellog.Bool("exception.escaped", true),
+		)
+		c.Lp.Logger(instrumentationName, otellog.WithInstrumentationVersion(instrumentationVersion())).Emit(ctx, record)
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), panicFlushTimeout)
+	defer cancel()
+	_ = ForceFlush(flushCtx)
+}
+
+// panicState tracks how far a panic value has been handled while it unwinds
+// through nested Trace and RecoverAndReport calls.
+type panicState struct {
+	seen     time.Time
+	recorded atomic.Bool // an exception event was added to a span
+	reported atomic.Bool // the error log was emitted and providers flushed
+}
+
+// panicStates maps a goroutine and a panic value to its panicState. Values
+// are compared with ==, so an entry expires after panicStateTTL, which covers
+// the flush done by an inner layer, in case the panic was recovered and an
+// equal value panics again later.
+var panicStates sync.Map // panicKey -> *panicState
+
+const panicStateTTL = 2 * panicFlushTimeout
+
+type panicKey struct {
+	goroutine uint64
+	value     any
+}
+
+// panicStateFor returns the state of the panic value r in the calling
+// goroutine. Values that cannot be used as map keys get a fresh state, and
+// are reported by every layer.
+func panicStateFor(r any) (state *panicState) {
+	now := time.Now()
+	state = &panicState{seen: now}
+	if t := reflect.TypeOf(r); t == nil || !t.Comparable() {
+		return state
+	}
+	// A comparable type can still hold an uncomparable value in an interface
+	// field, which makes hashing it panic.
+	defer func() {
+		if recover() != nil {
+			state = &panicState{seen: now}
+		}
+	}()
+	panicStates.Range(func(k, v any) bool {
+		if now.Sub(v.(*panicState).seen) > panicStateTTL {
+			panicStates.CompareAndDelete(k, v)
+		}
+		return true
+	})
+	actual, _ := panicStates.LoadOrStore(panicKey{goroutineID(), r}, state)
+	return actual.(*panicState)
+}
+
+// goroutineID parses the ID of the calling goroutine from its stack header,
+// "goroutine 42 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// ForceFlush exports all telemetry buffered by the tracker's providers,
+// honouring the deadline of ctx.
+func ForceFlush(ctx context.Context) error {
+	c := activeConfig.Load()
+	if c == nil {
+		return nil
+	}
+	var errs []error
+	if c.Tp != nil {
+		errs = append(errs, c.Tp.ForceFlush(ctx))
+	}
+	if c.Lp != nil {
+		errs = append(errs, c.Lp.ForceFlush(ctx))
+	}
+	if mp := activeMeterProvider.Load(); mp != nil {
+		errs = append(errs, mp.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// flushCounter counts ForceFlush calls on the tracer provider.
+type flushCounter struct {
+	sdktrace.SpanProcessor
+	flushes int
+}
+
+func (f *flushCounter) ForceFlush(ctx context.Context) error {
+	f.flushes++
+	return f.SpanProcessor.ForceFlush(ctx)
+}
+
+func TestPanicReportedOnce(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	counter := &flushCounter{SpanProcessor: sdktrace.NewSimpleSpanProcessor(exporter)}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(counter))
+	activeConfig.Store(&Config{Tp: tp})
+	defer activeConfig.Store(nil)
+
+	boom := errors.New("boom")
+	var recovered any
+	func() {
+		defer func() { recovered = recover() }()
+		ctx, span := StartSpan(context.Background(), "outer")
+		defer span.End()
+		defer RecoverAndReport(ctx)
+		defer RecoverAndReport(ctx)
+		_ = Trace(ctx, "middle", func(ctx context.Context) error {
+			return Trace(ctx, "inner", func(context.Context) error {
+				panic(boom)
+			})
+		})
+	}()
+
+	if recovered != boom {
+		t.Fatalf("recovered %v, want the original panic value", recovered)
+	}
+	events := 0
+	for _, span := range exporter.GetSpans() {
+		for _, event := range span.Events {
+			if event.Name == "exception" {
+				events++
+			}
+		}
+		if span.Status.Description != "panic: boom" {
+			t.Errorf("span %s status = %q, want panic: boom", span.Name, span.Status.Description)
+		}
+	}
+	if events != 1 {
+		t.Errorf("got %d exception events, want 1", events)
+	}
+	if counter.flushes != 1 {
+		t.Errorf("got %d flushes, want 1", counter.flushes)
+	}
+}
+
+// Panics with an equal value in different goroutines are reported each.
+func TestPanicStateIsPerGoroutine(t *testing.T) {
+	state := panicStateFor("boom")
+	state.reported.Store(true)
+	done := make(chan *panicState)
+	go func() { done <- panicStateFor("boom") }()
+	if other := <-done; other.reported.Load() {
+		t.Error("panic state shared between goroutines")
+	}
+	if again := panicStateFor("boom"); again != state {
+		t.Error("panic state not found again in the same goroutine")
+	}
+	if a, b := panicStateFor([]int{1}), panicStateFor([]int{1}); a == b {
+		t.Error("uncomparable panic values share a state")
+	}
+}
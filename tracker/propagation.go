@@ -0,0 +1,123 @@
+package tracker
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/contrib/propagators/ot"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Propagator names accepted by WithPropagators and OTEL_PROPAGATORS.
+const (
+	PropagatorTraceContext = "tracecontext" // W3C traceparent/tracestate
+	PropagatorBaggage      = "baggage"      // W3C baggage
+	PropagatorB3           = "b3"           // B3 single header ("b3")
+	PropagatorB3Multi      = "b3multi"      // B3 multi header ("X-B3-*")
+	PropagatorJaeger       = "jaeger"       // Jaeger "uber-trace-id"
+	PropagatorXRay         = "xray"         // AWS X-Ray "X-Amzn-Trace-Id"
+	PropagatorOTTrace      = "ottrace"      // OpenTracing "ot-tracer-*"
+	PropagatorNone         = "none"         // disable propagation
+)
+
+// defaultPropagators is used when neither WithPropagators nor
+// OTEL_PROPAGATORS is set.
+var defaultPropagators = []string{PropagatorB3Multi, PropagatorTraceContext, PropagatorBaggage}
+
+// WithPropagators selects the context propagation formats by name, e.g.
+// track.WithPropagators(track.PropagatorTraceContext, track.PropagatorJaeger).
+// It takes precedence over OTEL_PROPAGATORS. B3 headers are extracted in
+// both encodings; "b3" injects the single header and "b3multi" the
+// X-B3-* headers. Listing both injects both.
+func WithPropagators(names ...string) Options {
+	return func(c *Config) {
+		c.propagatorNames = names
+	}
+}
+
+// WithTextMapPropagator uses p for context propagation instead of the
+// propagators selected by name.
+func WithTextMapPropagator(p propagation.TextMapPropagator) Options {
+	return func(c *Config) {
+		c.propagator = p
+	}
+}
+
+// WithoutGlobalPropagator keeps Track from installing its propagator with
+// otel.SetTextMapPropagator. Use Config.Propagator to get it instead.
+func WithoutGlobalPropagator() Options {
+	return func(c *Config) {
+		c.skipGlobalPropagator = true
+	}
+}
+
+// Propagator returns the propagator configured for the tracker.
+func (c *Config) Propagator() propagation.TextMapPropagator {
+	return c.propagator
+}
+
+// ActivePropagator returns the propagator configured by Track, or the global
+// one before Track is called.
+func ActivePropagator() propagation.TextMapPropagator {
+	if c := activeConfig.Load(); c != nil && c.propagator != nil {
+		return c.propagator
+	}
+	return otel.GetTextMapPropagator()
+}
+
+// newPropagator builds a composite propagator from propagator names.
+// Unknown names are logged and ignored.
+func newPropagator(names []string) propagation.TextMapPropagator {
+	var (
+		propagators []propagation.TextMapPropagator
+		b3Encoding  b3.Encoding
+		b3Index     = -1
+	)
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3, PropagatorB3Multi:
+			if strings.EqualFold(strings.TrimSpace(name), PropagatorB3) {
+				b3Encoding |= b3.B3SingleHeader
+			} else {
+				b3Encoding |= b3.B3MultipleHeader
+			}
+			// Keep a single B3 propagator at the position of the first mention.
+			if b3Index < 0 {
+				b3Index = len(propagators)
+				propagators = append(propagators, nil)
+			}
+		case PropagatorJaeger:
+			propagators = append(propagators, jaeger.Jaeger{})
+		case PropagatorXRay:
+			propagators = append(propagators, xray.Propagator{})
+		case PropagatorOTTrace:
+			propagators = append(propagators, ot.OT{})
+		case PropagatorNone, "":
+		default:
+			log.Printf("unsupported propagator: %s\n", name)
+		}
+	}
+	if b3Index >= 0 {
+		propagators[b3Index] = b3.New(b3.WithInjectEncoding(b3Encoding))
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...)
+}
+
+// propagatorNamesFromEnv reads OTEL_PROPAGATORS, a comma separated list of
+// propagator names.
+func propagatorNamesFromEnv() []string {
+	env := os.Getenv("OTEL_PROPAGATORS")
+	if strings.TrimSpace(env) == "" {
+		return nil
+	}
+	return strings.Split(env, ",")
+}
@@ -0,0 +1,152 @@
+package tracker
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// trackForTest runs Track with every signal paused, restoring the global
+// propagator and the active config at the end of the test.
+func trackForTest(t *testing.T, opts ...Options) *Config {
+	t.Helper()
+	previous := otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTextMapPropagator(previous)
+		activeConfig.Store(nil)
+	})
+	opts = append([]Options{
+		WithConfigTag(PauseTraces, true),
+		WithConfigTag(PauseLogs, true),
+		WithConfigTag(PauseMetrics, true),
+		WithConfigTag(PauseProfiling, true),
+		WithConfigTag(PauseCloudDetection, true),
+	}, opts...)
+	c, err := Track(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// injectedHeaders returns the sorted names of the headers p injects for a
+// sampled span with a baggage member.
+func injectedHeaders(t *testing.T, p propagation.TextMapPropagator) []string {
+	t.Helper()
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	member, err := baggage.NewMember("tenant", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := baggage.ContextWithBaggage(trace.ContextWithSpanContext(context.Background(), sc), bag)
+	carrier := propagation.MapCarrier{}
+	p.Inject(ctx, carrier)
+	keys := carrier.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+func TestNewPropagator(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{PropagatorTraceContext}, []string{"traceparent"}},
+		{[]string{PropagatorBaggage}, []string{"baggage"}},
+		{[]string{PropagatorB3}, []string{"b3"}},
+		{[]string{PropagatorB3Multi}, []string{"x-b3-sampled", "x-b3-spanid", "x-b3-traceid"}},
+		{[]string{PropagatorB3, PropagatorB3Multi}, []string{"b3", "x-b3-sampled", "x-b3-spanid", "x-b3-traceid"}},
+		{[]string{PropagatorJaeger}, []string{"uber-trace-id"}},
+		{[]string{PropagatorXRay}, []string{"X-Amzn-Trace-Id"}},
+		{[]string{PropagatorOTTrace}, []string{"ot-baggage-tenant", "ot-tracer-sampled", "ot-tracer-spanid", "ot-tracer-traceid"}},
+		{[]string{" TraceContext ", "BAGGAGE"}, []string{"baggage", "traceparent"}},
+		{[]string{PropagatorNone}, nil},
+		{[]string{"zipkin"}, nil},
+		{[]string{"zipkin", PropagatorTraceContext}, []string{"traceparent"}},
+		{[]string{""}, nil},
+	}
+	for _, tt := range tests {
+		if got := injectedHeaders(t, newPropagator(tt.names)); !slices.Equal(got, tt.want) {
+			t.Errorf("newPropagator(%q) injects %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestTrackPropagators(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		opts []Options
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"baggage", "traceparent", "x-b3-sampled", "x-b3-spanid", "x-b3-traceid"},
+		},
+		{
+			name: "OTEL_PROPAGATORS",
+			env:  "jaeger,baggage",
+			want: []string{"baggage", "uber-trace-id"},
+		},
+		{
+			name: "OTEL_PROPAGATORS none",
+			env:  "none",
+		},
+		{
+			name: "WithPropagators takes precedence",
+			env:  "jaeger",
+			opts: []Options{WithPropagators(PropagatorTraceContext)},
+			want: []string{"traceparent"},
+		},
+		{
+			name: "WithTextMapPropagator",
+			env:  "jaeger",
+			opts: []Options{WithTextMapPropagator(propagation.Baggage{})},
+			want: []string{"baggage"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_PROPAGATORS", tt.env)
+			c := trackForTest(t, tt.opts...)
+			if got := injectedHeaders(t, c.Propagator()); !slices.Equal(got, tt.want) {
+				t.Errorf("Config.Propagator() injects %q, want %q", got, tt.want)
+			}
+			if got := injectedHeaders(t, otel.GetTextMapPropagator()); !slices.Equal(got, tt.want) {
+				t.Errorf("global propagator injects %q, want %q", got, tt.want)
+			}
+			if got := injectedHeaders(t, ActivePropagator()); !slices.Equal(got, tt.want) {
+				t.Errorf("ActivePropagator() injects %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithoutGlobalPropagator(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	c := trackForTest(t, WithoutGlobalPropagator(), WithPropagators(PropagatorJaeger))
+	if got := injectedHeaders(t, otel.GetTextMapPropagator()); !slices.Equal(got, []string{"traceparent"}) {
+		t.Errorf("global propagator injects %q, want the one set before Track", got)
+	}
+	want := []string{"uber-trace-id"}
+	if got := injectedHeaders(t, c.Propagator()); !slices.Equal(got, want) {
+		t.Errorf("Config.Propagator() injects %q, want %q", got, want)
+	}
+	if got := injectedHeaders(t, ActivePropagator()); !slices.Equal(got, want) {
+		t.Errorf("ActivePropagator() injects %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,392 @@
+package tracker
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// addCustomResourceAttributes appends the customResourceAttributes config tag
+// and the MW_CUSTOM_RESOURCE_ATTRIBUTES environment variable to attributes.
+func addCustomResourceAttributes(attributes []attribute.KeyValue, c *Config) []attribute.KeyValue {
+	attributes = appendValueAttributes(attributes, "", reflect.ValueOf(c.customResourceAttributes))
+	return append(attributes, parseResourceAttributes(os.Getenv("MW_CUSTOM_RESOURCE_ATTRIBUTES"))...)
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// maxAttributeDepth bounds how deeply nested structs, maps and slices are
+// flattened into attributes.
+const maxAttributeDepth = 10
+
+// appendValueAttributes converts v into attributes under key. Scalars map to
+// their attribute type, slices and arrays of scalars to array attributes, and
+// maps and structs are flattened into dotted keys ("key.field"). Struct fields
+// honour mw tags, see Attributes. Values nested deeper than maxAttributeDepth
+// and pointers or maps referring back to a value being converted are skipped.
+func appendValueAttributes(attributes []attribute.KeyValue, key string, v reflect.Value) []attribute.KeyValue {
+	return appendNestedAttributes(attributes, key, v, 0, nil)
+}
+
+// visit identifies a pointer or map on the path being converted. The type
+// tells apart a struct from its first field, which share an address.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func appendNestedAttributes(attributes []attribute.KeyValue, key string, v reflect.Value, depth int, path map[visit]bool) []attribute.KeyValue {
+	if depth > maxAttributeDepth {
+		return attributes
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return attributes
+		}
+		if v.Kind() == reflect.Pointer {
+			var ok bool
+			if path, ok = enterVisit(path, v); !ok {
+				return attributes
+			}
+			defer delete(path, visit{v.Pointer(), v.Type()})
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return attributes
+	}
+
+	if kv, ok := scalarAttribute(key, v); ok {
+		return append(attributes, kv)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if kv, ok := sliceAttribute(key, v); ok {
+			return append(attributes, kv)
+		}
+		// Elements that are not scalars, e.g. structs, are flattened by
+		// index ("key.0.field").
+		for i := 0; i < v.Len(); i++ {
+			attributes = appendNestedAttributes(attributes, joinKey(key, strconv.Itoa(i)), v.Index(i), depth+1, path)
+		}
+		return attributes
+	case reflect.Map:
+		if v.IsNil() {
+			return attributes
+		}
+		var ok bool
+		if path, ok = enterVisit(path, v); !ok {
+			return attributes
+		}
+		defer delete(path, visit{v.Pointer(), v.Type()})
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			attributes = appendNestedAttributes(attributes, joinKey(key, fmt.Sprint(k.Interface())), v.MapIndex(k), depth+1, path)
+		}
+		return attributes
+	case reflect.Struct:
+		for _, f := range cachedStructFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && fv.IsZero()) {
+				continue
+			}
+			if f.redact {
+				attributes = append(attributes, attribute.String(joinKey(key, f.name), redacted))
+				continue
+			}
+			attributes = appendNestedAttributes(attributes, joinKey(key, f.name), fv, depth+1, path)
+		}
+		return attributes
+	}
+	log.Printf("Unsupported attribute type %s for key: %s\n", v.Type(), key)
+	return attributes
+}
+
+// enterVisit adds the pointer or map v to path, allocating it on first use.
+// It reports false when v is already on the path, i.e. the value refers
+// back to itself.
+func enterVisit(path map[visit]bool, v reflect.Value) (map[visit]bool, bool) {
+	k := visit{v.Pointer(), v.Type()}
+	if path[k] {
+		return path, false
+	}
+	if path == nil {
+		path = make(map[visit]bool)
+	}
+	path[k] = true
+	return path, true
+}
+
+// scalarAttribute converts a single value, reporting false when v is not a
+// scalar.
+func scalarAttribute(key string, v reflect.Value) (attribute.KeyValue, bool) {
+	switch v.Type() {
+	case timeType:
+		return attribute.String(key, v.Interface().(time.Time).Format(time.RFC3339Nano)), true
+	case durationType:
+		return attribute.String(key, v.Interface().(time.Duration).String()), true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return attribute.String(key, v.String()), true
+	case reflect.Bool:
+		return attribute.Bool(key, v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return attribute.Int64(key, v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u <= math.MaxInt64 {
+			return attribute.Int64(key, int64(u)), true
+		}
+		return attribute.String(key, strconv.FormatUint(v.Uint(), 10)), true
+	case reflect.Float32, reflect.Float64:
+		return attribute.Float64(key, v.Float()), true
+	}
+	if v.Type().Implements(stringerType) {
+		return attribute.String(key, v.Interface().(fmt.Stringer).String()), true
+	}
+	return attribute.KeyValue{}, false
+}
+
+// sliceAttribute converts a slice or array of scalars into an array
+// attribute. Elements of mixed types are rendered as strings, and nil
+// elements as empty strings.
+func sliceAttribute(key string, v reflect.Value) (attribute.KeyValue, bool) {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return attribute.String(key, string(v.Bytes())), true
+	}
+	elems := make([]attribute.KeyValue, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		for (e.Kind() == reflect.Pointer || e.Kind() == reflect.Interface) && !e.IsNil() {
+			e = e.Elem()
+		}
+		if (e.Kind() == reflect.Pointer || e.Kind() == reflect.Interface) && e.IsNil() {
+			// Calling String on a nil Stringer would panic.
+			elems = append(elems, attribute.String(key, ""))
+			continue
+		}
+		kv, ok := scalarAttribute(key, e)
+		if !ok {
+			return attribute.KeyValue{}, false
+		}
+		elems = append(elems, kv)
+	}
+
+	kind := attribute.STRING
+	if len(elems) > 0 {
+		kind = elems[0].Value.Type()
+		for _, e := range elems[1:] {
+			if t := e.Value.Type(); t != kind {
+				// Ints and floats mix into a float array, anything else
+				// into a string array.
+				if (t == attribute.INT64 || t == attribute.FLOAT64) && (kind == attribute.INT64 || kind == attribute.FLOAT64) {
+					kind = attribute.FLOAT64
+				} else {
+					kind = attribute.STRING
+				}
+			}
+		}
+	}
+
+	switch kind {
+	case attribute.BOOL:
+		values := make([]bool, len(elems))
+		for i, e := range elems {
+			values[i] = e.Value.AsBool()
+		}
+		return attribute.BoolSlice(key, values), true
+	case attribute.INT64:
+		values := make([]int64, len(elems))
+		for i, e := range elems {
+			values[i] = e.Value.AsInt64()
+		}
+		return attribute.Int64Slice(key, values), true
+	case attribute.FLOAT64:
+		values := make([]float64, len(elems))
+		for i, e := range elems {
+			if e.Value.Type() == attribute.INT64 {
+				values[i] = float64(e.Value.AsInt64())
+			} else {
+				values[i] = e.Value.AsFloat64()
+			}
+		}
+		return attribute.Float64Slice(key, values), true
+	default:
+		values := make([]string, len(elems))
+		for i, e := range elems {
+			values[i] = e.Value.Emit()
+		}
+		return attribute.StringSlice(key, values), true
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// snakeCase turns a Go field name such as "HTTPStatusCode" into
+// "http_status_code".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// parseResourceAttributes parses a MW_CUSTOM_RESOURCE_ATTRIBUTES value of
+// comma separated key=value pairs. A key may carry a type suffix
+// ("replicas:int=3"); supported types are string, bool, int and float, and
+// string[], bool[], int[] and float[] for arrays, whose elements are
+// separated by ';'. A backslash escapes ',', '=', ':', ';' and itself.
+func parseResourceAttributes(s string) []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+	for _, pair := range splitUnescaped(s, ',') {
+		kv := splitUnescapedN(pair, '=', 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, typ := strings.TrimSpace(kv[0]), "string"
+		if kt := splitUnescapedN(key, ':', 2); len(kt) == 2 && resourceAttributeTypes[strings.TrimSpace(kt[1])] {
+			key, typ = strings.TrimSpace(kt[0]), strings.TrimSpace(kt[1])
+		}
+		key = unescape(key)
+		if key == "" {
+			continue
+		}
+		kv2, err := typedAttribute(key, typ, strings.TrimSpace(kv[1]))
+		if err != nil {
+			log.Printf("invalid value for resource attribute %s: %v\n", key, err)
+			kv2 = attribute.String(key, unescape(strings.TrimSpace(kv[1])))
+		}
+		attributes = append(attributes, kv2)
+	}
+	return attributes
+}
+
+var resourceAttributeTypes = map[string]bool{
+	"string": true, "bool": true, "int": true, "float": true,
+	"string[]": true, "bool[]": true, "int[]": true, "float[]": true,
+}
+
+func typedAttribute(key, typ, raw string) (attribute.KeyValue, error) {
+	if elemType, ok := strings.CutSuffix(typ, "[]"); ok {
+		parts := splitUnescaped(raw, ';')
+		values := make([]attribute.KeyValue, 0, len(parts))
+		for _, p := range parts {
+			v, err := typedAttribute(key, elemType, strings.TrimSpace(p))
+			if err != nil {
+				return attribute.KeyValue{}, err
+			}
+			values = append(values, v)
+		}
+		switch elemType {
+		case "string":
+			out := make([]string, len(values))
+			for i, v := range values {
+				out[i] = v.Value.AsString()
+			}
+			return attribute.StringSlice(key, out), nil
+		case "bool":
+			out := make([]bool, len(values))
+			for i, v := range values {
+				out[i] = v.Value.AsBool()
+			}
+			return attribute.BoolSlice(key, out), nil
+		case "int":
+			out := make([]int64, len(values))
+			for i, v := range values {
+				out[i] = v.Value.AsInt64()
+			}
+			return attribute.Int64Slice(key, out), nil
+		case "float":
+			out := make([]float64, len(values))
+			for i, v := range values {
+				out[i] = v.Value.AsFloat64()
+			}
+			return attribute.Float64Slice(key, out), nil
+		}
+		return attribute.KeyValue{}, fmt.Errorf("unknown type %q", typ)
+	}
+
+	value := unescape(raw)
+	switch typ {
+	case "string":
+		return attribute.String(key, value), nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		return attribute.Bool(key, b), err
+	case "int":
+		i, err := strconv.ParseInt(value, 10, 64)
+		return attribute.Int64(key, i), err
+	case "float":
+		f, err := strconv.ParseFloat(value, 64)
+		return attribute.Float64(key, f), err
+	}
+	return attribute.KeyValue{}, fmt.Errorf("unknown type %q", typ)
+}
+
+// splitUnescaped splits s around each sep that is not escaped with a
+// backslash. Escape sequences are kept so that later stages can split again.
+func splitUnescaped(s string, sep byte) []string {
+	return splitUnescapedN(s, sep, -1)
+}
+
+func splitUnescapedN(s string, sep byte, n int) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			if n > 0 && len(parts) == n-1 {
+				continue
+			}
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,189 @@
+package tracker
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestParseResourceAttributes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []attribute.KeyValue
+	}{
+		{
+			name: "strings",
+			in:   "team=payments, region = eu-west-1",
+			want: []attribute.KeyValue{
+				attribute.String("team", "payments"),
+				attribute.String("region", "eu-west-1"),
+			},
+		},
+		{
+			name: "typed values",
+			in:   "replicas:int=3,canary:bool=true,ratio:float=0.25,tier:string=gold",
+			want: []attribute.KeyValue{
+				attribute.Int64("replicas", 3),
+				attribute.Bool("canary", true),
+				attribute.Float64("ratio", 0.25),
+				attribute.String("tier", "gold"),
+			},
+		},
+		{
+			name: "arrays",
+			in:   "zones:string[]=a;b;c,ports:int[]=80; 443,flags:bool[]=true;false,weights:float[]=0.5;1",
+			want: []attribute.KeyValue{
+				attribute.StringSlice("zones", []string{"a", "b", "c"}),
+				attribute.Int64Slice("ports", []int64{80, 443}),
+				attribute.BoolSlice("flags", []bool{true, false}),
+				attribute.Float64Slice("weights", []float64{0.5, 1}),
+			},
+		},
+		{
+			name: "escapes",
+			in:   `owner=a\,b,query=x\=1,url\:path=/x,list:string[]=a\;b;c,slash=a\\b`,
+			want: []attribute.KeyValue{
+				attribute.String("owner", "a,b"),
+				attribute.String("query", "x=1"),
+				attribute.String("url:path", "/x"),
+				attribute.StringSlice("list", []string{"a;b", "c"}),
+				attribute.String("slash", `a\b`),
+			},
+		},
+		{
+			name: "value containing separators",
+			in:   "dsn=host=db port=5432",
+			want: []attribute.KeyValue{attribute.String("dsn", "host=db port=5432")},
+		},
+		{
+			name: "unknown type is part of the key",
+			in:   "build:sha=abc",
+			want: []attribute.KeyValue{attribute.String("build:sha", "abc")},
+		},
+		{
+			name: "invalid typed values fall back to strings",
+			in:   "replicas:int=three,ports:int[]=80;http,canary:bool=maybe",
+			want: []attribute.KeyValue{
+				attribute.String("replicas", "three"),
+				attribute.String("ports", "80;http"),
+				attribute.String("canary", "maybe"),
+			},
+		},
+		{
+			name: "malformed pairs are skipped",
+			in:   "novalue,=orphan,:int=1,,ok=1",
+			want: []attribute.KeyValue{attribute.String("ok", "1")},
+		},
+		{
+			name: "trailing backslash",
+			in:   `path=C:\`,
+			want: []attribute.KeyValue{attribute.String("path", `C:\`)},
+		},
+		{
+			name: "empty",
+			in:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseResourceAttributes(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseResourceAttributes(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitUnescaped(t *testing.T) {
+	tests := []struct {
+		in   string
+		sep  byte
+		n    int
+		want []string
+	}{
+		{"a,b,c", ',', -1, []string{"a", "b", "c"}},
+		{`a\,b,c`, ',', -1, []string{`a\,b`, "c"}},
+		{`a\\,b`, ',', -1, []string{`a\\`, "b"}},
+		{"k=v=w", '=', 2, []string{"k", "v=w"}},
+		{"", ',', -1, []string{""}},
+		{"a,", ',', -1, []string{"a", ""}},
+	}
+	for _, tt := range tests {
+		if got := splitUnescapedN(tt.in, tt.sep, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitUnescapedN(%q, %q, %d) = %q, want %q", tt.in, tt.sep, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"ID":             "id",
+		"UserID":         "user_id",
+		"HTTPStatusCode": "http_status_code",
+		"name":           "name",
+		"RetryAfter":     "retry_after",
+	}
+	for in, want := range tests {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// label has a String method with a pointer receiver.
+type label struct{ name string }
+
+func (l *label) String() string { return "label:" + l.name }
+
+type level struct{ n int }
+
+func (l level) String() string { return fmt.Sprintf("L%d", l.n) }
+
+func TestAppendValueAttributes(t *testing.T) {
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value any
+		want  []attribute.KeyValue
+	}{
+		{"string", "eu", []attribute.KeyValue{attribute.String("k", "eu")}},
+		{"uint", uint8(7), []attribute.KeyValue{attribute.Int64("k", 7)}},
+		{"large uint", uint64(1 << 63), []attribute.KeyValue{attribute.String("k", "9223372036854775808")}},
+		{"float", float32(0.5), []attribute.KeyValue{attribute.Float64("k", 0.5)}},
+		{"time", when, []attribute.KeyValue{attribute.String("k", "2024-05-01T12:00:00Z")}},
+		{"duration", 1500 * time.Millisecond, []attribute.KeyValue{attribute.String("k", "1.5s")}},
+		{"stringer", level{3}, []attribute.KeyValue{attribute.String("k", "L3")}},
+		{"bytes", []byte("raw"), []attribute.KeyValue{attribute.String("k", "raw")}},
+		{"nil pointer", (*int)(nil), nil},
+		{"int slice", []int{1, 2}, []attribute.KeyValue{attribute.Int64Slice("k", []int64{1, 2})}},
+		{"array", [2]bool{true, false}, []attribute.KeyValue{attribute.BoolSlice("k", []bool{true, false})}},
+		{"ints and floats", []any{1, 2.5}, []attribute.KeyValue{attribute.Float64Slice("k", []float64{1, 2.5})}},
+		{"mixed", []any{1, "a", true}, []attribute.KeyValue{attribute.StringSlice("k", []string{"1", "a", "true"})}},
+		{"nil Stringer elements", []fmt.Stringer{level{1}, nil}, []attribute.KeyValue{attribute.StringSlice("k", []string{"L1", ""})}},
+		{"nil pointer Stringer elements", []*label{nil}, []attribute.KeyValue{attribute.StringSlice("k", []string{""})}},
+		{"pointer elements", []*int{new(int)}, []attribute.KeyValue{attribute.Int64Slice("k", []int64{0})}},
+		{
+			"map",
+			map[string]any{"b": 2, "a": map[string]string{"x": "y"}},
+			[]attribute.KeyValue{attribute.String("k.a.x", "y"), attribute.Int64("k.b", 2)},
+		},
+		{
+			"slice of maps",
+			[]map[string]int{{"n": 1}, {"n": 2}},
+			[]attribute.KeyValue{attribute.Int64("k.0.n", 1), attribute.Int64("k.1.n", 2)},
+		},
+		{"unsupported", make(chan int), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendValueAttributes(nil, "k", reflect.ValueOf(tt.value))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendValueAttributes(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
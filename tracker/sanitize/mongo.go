@@ -0,0 +1,222 @@
+package sanitize
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mongo returns a filter, update or pipeline document as JSON with its
+// values replaced with "?", keeping field names and operators:
+//
+//	{"age": {"$gt": "?"}, "status": {"$in": ["?"]}}
+//
+// doc is JSON text, as a string or []byte, or a Go value: maps with string
+// keys, slices, structs marshaled by encoding/json, or ordered documents
+// such as bson.D, whose elements have Key and Value fields. Arrays of
+// scalars collapse to a single "?".
+func Mongo(doc any) string {
+	var b strings.Builder
+	switch d := doc.(type) {
+	case string:
+		scrubJSON(&b, []byte(d))
+	case []byte:
+		scrubJSON(&b, d)
+	case json.RawMessage:
+		scrubJSON(&b, d)
+	default:
+		scrubValue(&b, reflect.ValueOf(doc))
+	}
+	return b.String()
+}
+
+// scrubValue writes the scrubbed form of v.
+func scrubValue(b *strings.Builder, v reflect.Value) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			b.WriteString(`"?"`)
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			b.WriteString(`"?"`)
+			return
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Quote(k))
+			b.WriteByte(':')
+			scrubValue(b, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())))
+		}
+		b.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			b.WriteString(`"?"`)
+			return
+		}
+		if isOrderedDocument(v.Type().Elem()) {
+			b.WriteByte('{')
+			for i := 0; i < v.Len(); i++ {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				e := v.Index(i)
+				b.WriteString(strconv.Quote(e.FieldByName("Key").String()))
+				b.WriteByte(':')
+				scrubValue(b, e.FieldByName("Value"))
+			}
+			b.WriteByte('}')
+			return
+		}
+		scrubArray(b, v.Len(), func(i int) bool { return isScalar(v.Index(i)) }, func(i int) {
+			scrubValue(b, v.Index(i))
+		})
+	case reflect.Struct:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			b.WriteString(`"?"`)
+			return
+		}
+		scrubJSON(b, data)
+	default:
+		b.WriteString(`"?"`)
+	}
+}
+
+// scrubArray writes an array of n elements, or ["?"] when they are all
+// scalars.
+func scrubArray(b *strings.Builder, n int, scalar func(int) bool, write func(int)) {
+	all := true
+	for i := 0; i < n && all; i++ {
+		all = scalar(i)
+	}
+	if all {
+		if n == 0 {
+			b.WriteString("[]")
+		} else {
+			b.WriteString(`["?"]`)
+		}
+		return
+	}
+	b.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		write(i)
+	}
+	b.WriteByte(']')
+}
+
+// isOrderedDocument reports whether t is the element of an ordered document
+// like bson.E.
+func isOrderedDocument(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t.NumField() != 2 {
+		return false
+	}
+	key, ok := t.FieldByName("Key")
+	if !ok || key.Type.Kind() != reflect.String {
+		return false
+	}
+	_, ok = t.FieldByName("Value")
+	return ok
+}
+
+func isScalar(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Struct, reflect.Array:
+		return false
+	case reflect.Slice:
+		return v.Type().Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
+
+// scrubJSON writes the scrubbed form of a JSON document, keeping the order
+// of its fields. Invalid JSON is replaced as a whole.
+func scrubJSON(b *strings.Builder, data []byte) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out strings.Builder
+	if err := scrubJSONValue(&out, dec); err != nil {
+		b.WriteString(`"?"`)
+		return
+	}
+	b.WriteString(out.String())
+}
+
+var errInvalidJSON = errors.New("invalid JSON")
+
+func scrubJSONValue(b *strings.Builder, dec *json.Decoder) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case json.Delim('{'):
+		b.WriteByte('{')
+		for i := 0; dec.More(); i++ {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Quote(key.(string)))
+			b.WriteByte(':')
+			if err := scrubJSONValue(b, dec); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		b.WriteByte('}')
+	case json.Delim('['):
+		var elements []string
+		scalars := true
+		for dec.More() {
+			var e strings.Builder
+			if err := scrubJSONValue(&e, dec); err != nil {
+				return err
+			}
+			s := e.String()
+			scalars = scalars && s == `"?"`
+			elements = append(elements, s)
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		scrubArray(b, len(elements), func(int) bool { return scalars }, func(i int) {
+			b.WriteString(elements[i])
+		})
+	case json.Delim('}'), json.Delim(']'):
+		return errInvalidJSON
+	default:
+		b.WriteString(`"?"`)
+	}
+	return nil
+}
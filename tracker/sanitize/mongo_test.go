@@ -0,0 +1,46 @@
+package sanitize
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// element is an element of an ordered document, like bson.E.
+type element struct {
+	Key   string
+	Value any
+}
+
+type filter struct {
+	Status string `json:"status"`
+	Age    int    `json:"age,omitempty"`
+}
+
+func TestMongo(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  any
+		want string
+	}{
+		{"json", `{"age": {"$gt": 30}, "status": {"$in": ["a", "b"]}}`, `{"age":{"$gt":"?"},"status":{"$in":["?"]}}`},
+		{"json keeps field order", `{"z": 1, "a": 2}`, `{"z":"?","a":"?"}`},
+		{"bytes", []byte(`{"token": "secret"}`), `{"token":"?"}`},
+		{"raw message", json.RawMessage(`[{"$match": {"user": "alice"}}]`), `[{"$match":{"user":"?"}}]`},
+		{"invalid json", `{"token": "secret"`, `"?"`},
+		{"map", map[string]any{"name": "alice", "tags": []string{"x", "y"}}, `{"name":"?","tags":["?"]}`},
+		{"nested arrays", map[string]any{"$or": []any{map[string]any{"a": 1}, map[string]any{"b": 2}}}, `{"$or":[{"a":"?"},{"b":"?"}]}`},
+		{"ordered document", []element{{"status", "active"}, {"age", map[string]any{"$lt": 65}}}, `{"status":"?","age":{"$lt":"?"}}`},
+		{"struct", filter{Status: "active"}, `{"status":"?"}`},
+		{"binary", map[string]any{"data": []byte("secret")}, `{"data":"?"}`},
+		{"empty array", map[string]any{"ids": []int{}}, `{"ids":[]}`},
+		{"nil", nil, `"?"`},
+		{"scalar", "secret", `"?"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mongo(tt.doc); got != tt.want {
+				t.Errorf("Mongo(%v) = %s, want %s", tt.doc, got, tt.want)
+			}
+		})
+	}
+}
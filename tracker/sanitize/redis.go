@@ -0,0 +1,76 @@
+package sanitize
+
+import (
+	"strings"
+)
+
+// redisRule tells which arguments of a Redis command are kept.
+type redisRule int
+
+const (
+	// redisKeepKey keeps the first argument, usually the key.
+	redisKeepKey redisRule = iota
+	// redisKeepAll keeps every argument: keys, fields, counts and ranges.
+	redisKeepAll
+	// redisKeepNone replaces every argument.
+	redisKeepNone
+	// redisKeepPairs keeps the keys of key value pairs.
+	redisKeepPairs
+	// redisKeepKeyAndPairs keeps the key and the fields of field value
+	// pairs following it.
+	redisKeepKeyAndPairs
+)
+
+var redisRules = map[string]redisRule{
+	"AUTH": redisKeepNone, "HELLO": redisKeepNone, "MIGRATE": redisKeepNone,
+
+	"MSET": redisKeepPairs, "MSETNX": redisKeepPairs,
+
+	"HSET": redisKeepKeyAndPairs, "HMSET": redisKeepKeyAndPairs, "HSETNX": redisKeepKeyAndPairs,
+
+	"DBSIZE": redisKeepAll, "DECR": redisKeepAll, "DECRBY": redisKeepAll, "DEL": redisKeepAll,
+	"EXISTS": redisKeepAll, "EXPIRE": redisKeepAll, "EXPIREAT": redisKeepAll, "FLUSHALL": redisKeepAll,
+	"FLUSHDB": redisKeepAll, "GET": redisKeepAll, "GETDEL": redisKeepAll, "HDEL": redisKeepAll,
+	"HEXISTS": redisKeepAll, "HGET": redisKeepAll, "HGETALL": redisKeepAll, "HINCRBY": redisKeepAll,
+	"HKEYS": redisKeepAll, "HLEN": redisKeepAll, "HMGET": redisKeepAll, "HVALS": redisKeepAll,
+	"INCR": redisKeepAll, "INCRBY": redisKeepAll, "INFO": redisKeepAll, "KEYS": redisKeepAll,
+	"LLEN": redisKeepAll, "LPOP": redisKeepAll, "LRANGE": redisKeepAll, "MGET": redisKeepAll,
+	"PERSIST": redisKeepAll, "PEXPIRE": redisKeepAll, "PING": redisKeepAll, "PTTL": redisKeepAll,
+	"RPOP": redisKeepAll, "SCAN": redisKeepAll, "SCARD": redisKeepAll, "SELECT": redisKeepAll,
+	"SMEMBERS": redisKeepAll, "TTL": redisKeepAll, "TYPE": redisKeepAll, "UNLINK": redisKeepAll,
+	"ZCARD": redisKeepAll, "ZRANGE": redisKeepAll, "ZREVRANGE": redisKeepAll,
+}
+
+// Redis returns the command line of a Redis command, with args[0] being the
+// command, and the values replaced with "?". Keys, fields and numeric
+// arguments of read commands are kept, e.g. "SET session:42 ?" or
+// "HSET user:7 name ? email ?". The arguments of AUTH are always replaced.
+func Redis(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	command := strings.ToUpper(args[0])
+	b := strings.Builder{}
+	b.WriteString(command)
+	rule := redisRules[command]
+	for i, arg := range args[1:] {
+		keep := false
+		switch rule {
+		case redisKeepKey:
+			keep = i == 0
+		case redisKeepAll:
+			keep = true
+		case redisKeepPairs:
+			keep = i%2 == 0
+		case redisKeepKeyAndPairs:
+			keep = i%2 == 1 || i == 0
+		}
+		b.WriteByte(' ')
+		if keep {
+			b.WriteString(arg)
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
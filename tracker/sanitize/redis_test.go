@@ -0,0 +1,27 @@
+package sanitize
+
+import "testing"
+
+func TestRedis(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"set", "session:42", "token"}, "SET session:42 ?"},
+		{[]string{"SET", "k", "v", "EX", "60"}, "SET k ? ? ?"},
+		{[]string{"get", "session:42"}, "GET session:42"},
+		{[]string{"AUTH", "default", "hunter2"}, "AUTH ? ?"},
+		{[]string{"HELLO", "3", "AUTH", "default", "hunter2"}, "HELLO ? ? ? ?"},
+		{[]string{"MSET", "a", "1", "b", "2"}, "MSET a ? b ?"},
+		{[]string{"HSET", "user:7", "name", "alice", "email", "a@example.com"}, "HSET user:7 name ? email ?"},
+		{[]string{"LRANGE", "queue", "0", "-1"}, "LRANGE queue 0 -1"},
+		{[]string{"append", "log", "secret"}, "APPEND log ?"},
+		{[]string{"PING"}, "PING"},
+	}
+	for _, tt := range tests {
+		if got := Redis(tt.args); got != tt.want {
+			t.Errorf("Redis(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
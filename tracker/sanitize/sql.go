@@ -0,0 +1,370 @@
+// Package sanitize strips the values out of database statements before they
+// are recorded on spans: the literals of SQL queries, the arguments of Redis
+// commands and the values of Mongo filter documents.
+package sanitize
+
+import (
+	"strings"
+)
+
+// Dialect selects the quoting rules of a SQL database.
+type Dialect int
+
+const (
+	// Generic quotes strings with ' and identifiers with " or `. As it is
+	// not known whether backslashes escape quotes, a string that ends at a
+	// different place when they do is treated as running to the end of the
+	// statement.
+	Generic Dialect = iota
+	// Postgres also has E'' escape strings, $tag$ dollar-quoted strings,
+	// $1 placeholders and nested block comments.
+	Postgres
+	// MySQL quotes strings with ' or ", identifiers with ` and escapes with
+	// backslashes. # starts a comment.
+	MySQL
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenPlaceholder
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// space reports whether whitespace or a comment came before the token.
+	space bool
+}
+
+// tokenize splits query into tokens, dropping whitespace and comments.
+// Unterminated strings and comments run to the end of query, so truncated
+// queries are handled too.
+func tokenize(query string, dialect Dialect) []token {
+	var tokens []token
+	space := false
+	emit := func(kind tokenKind, start, end int) int {
+		tokens = append(tokens, token{kind: kind, text: query[start:end], space: space})
+		space = false
+		return end
+	}
+
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			space = true
+			i++
+		case ch == '-' && next(query, i) == '-', ch == '#' && dialect == MySQL:
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+		case ch == '/' && next(query, i) == '*':
+			i = commentEnd(query, i, dialect == Postgres)
+			space = true
+		case ch == '\'':
+			i = emit(tokenString, i, stringEnd(query, i, dialect == MySQL, dialect))
+		case ch == '"' && dialect == MySQL:
+			i = emit(tokenString, i, quotedEnd(query, i, true))
+		case ch == '"' || ch == '`':
+			i = emit(tokenIdentifier, i, quotedEnd(query, i, false))
+		case strings.IndexByte("eEnNbBxX", ch) >= 0 && next(query, i) == '\'' && (i == 0 || !isWord(query[i-1])):
+			backslash := dialect == MySQL || ch == 'e' || ch == 'E'
+			i = emit(tokenString, i, stringEnd(query, i+1, backslash, dialect))
+		case ch == '$' && isDigit(next(query, i)):
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			i = emit(tokenPlaceholder, i, j)
+		case ch == '$' && dialect == Postgres:
+			if end, ok := dollarQuotedEnd(query, i); ok {
+				i = emit(tokenString, i, end)
+			} else {
+				i = emit(tokenPunct, i, i+1)
+			}
+		case ch == '?':
+			i = emit(tokenPlaceholder, i, i+1)
+		case ch == ':' && isWordStart(next(query, i)) && (i == 0 || query[i-1] != ':'):
+			j := i + 1
+			for j < len(query) && isWord(query[j]) {
+				j++
+			}
+			i = emit(tokenPlaceholder, i, j)
+		case isDigit(ch) || ch == '.' && isDigit(next(query, i)):
+			i = emit(tokenNumber, i, numberEnd(query, i))
+		case ch == '-' && isDigit(next(query, i)) && unary(tokens):
+			i = emit(tokenNumber, i, numberEnd(query, i+1))
+		case isWordStart(ch) || ch == '@':
+			j := i + 1
+			for j < len(query) && isWord(query[j]) {
+				j++
+			}
+			i = emit(tokenWord, i, j)
+		default:
+			j := i + 1
+			if j < len(query) && isOperatorPair(ch, query[j]) {
+				j++
+				if query[i:j] == "->" && j < len(query) && query[j] == '>' {
+					j++
+				}
+			}
+			i = emit(tokenPunct, i, j)
+		}
+	}
+	return tokens
+}
+
+// SQL returns query with its string and number literals replaced with "?",
+// comments removed and whitespace collapsed. Placeholders, identifiers and
+// keywords are kept as written.
+func SQL(query string, dialect Dialect) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i, t := range tokenize(query, dialect) {
+		if t.space && i > 0 {
+			b.WriteByte(' ')
+		}
+		switch t.kind {
+		case tokenString, tokenNumber:
+			b.WriteByte('?')
+		default:
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
+
+// Fingerprint returns a normalized form of query that is the same for every
+// execution of a statement, suitable as a low-cardinality span name. Literals
+// and placeholders become "?", lists of values collapse to one, known
+// keywords are upper-cased and spacing is canonical:
+//
+//	select * from users where id in (1, 2, 3) -- admin
+//
+// becomes
+//
+//	SELECT * FROM users WHERE id IN (?)
+func Fingerprint(query string, dialect Dialect) string {
+	tokens := tokenize(query, dialect)
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	var b strings.Builder
+	b.Grow(len(query))
+	var prev token
+	for i, t := range tokens {
+		text := t.text
+		switch t.kind {
+		case tokenString, tokenNumber, tokenPlaceholder:
+			text = "?"
+		case tokenWord:
+			if upper := strings.ToUpper(text); keywords[upper] {
+				text = upper
+			}
+		}
+		if i > 0 && spaced(prev, t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(text)
+		prev = t
+	}
+
+	fingerprint := b.String()
+	for _, list := range [][2]string{{"?, ?", "?"}, {"(?), (?)", "(?)"}} {
+		for strings.Contains(fingerprint, list[0]) {
+			fingerprint = strings.ReplaceAll(fingerprint, list[0], list[1])
+		}
+	}
+	return fingerprint
+}
+
+// Operation returns the upper-cased first keyword of query, e.g. "SELECT",
+// or "" when query does not start with a word.
+func Operation(query string) string {
+	for _, t := range tokenize(query, Generic) {
+		switch {
+		case t.kind == tokenWord:
+			return strings.ToUpper(t.text)
+		case t.text != "(":
+			return ""
+		}
+	}
+	return ""
+}
+
+// spaced reports whether Fingerprint separates t from the token before it.
+func spaced(prev, t token) bool {
+	switch t.text {
+	case ",", ")", ".", "::", ";":
+		return false
+	case "(":
+		// Function calls and column lists stay attached to their name.
+		return prev.kind != tokenWord && prev.kind != tokenIdentifier || keywords[strings.ToUpper(prev.text)]
+	}
+	switch prev.text {
+	case "(", ".", "::":
+		return false
+	}
+	return true
+}
+
+// keywords are upper-cased by Fingerprint.
+var keywords = map[string]bool{
+	"ALL": true, "ALTER": true, "AND": true, "AS": true, "ASC": true,
+	"BEGIN": true, "BETWEEN": true, "BY": true, "CASE": true, "COMMIT": true,
+	"CREATE": true, "CROSS": true, "DELETE": true, "DESC": true, "DISTINCT": true,
+	"DROP": true, "ELSE": true, "END": true, "EXISTS": true, "FALSE": true,
+	"FOR": true, "FROM": true, "FULL": true, "GROUP": true, "HAVING": true,
+	"ILIKE": true, "IN": true, "INDEX": true, "INNER": true, "INSERT": true,
+	"INTO": true, "IS": true, "JOIN": true, "LEFT": true, "LIKE": true,
+	"LIMIT": true, "NOT": true, "NULL": true, "OFFSET": true, "ON": true,
+	"OR": true, "ORDER": true, "OUTER": true, "RETURNING": true, "RIGHT": true,
+	"ROLLBACK": true, "SELECT": true, "SET": true, "TABLE": true, "THEN": true,
+	"TRUE": true, "UNION": true, "UPDATE": true, "USING": true, "VALUES": true,
+	"WHEN": true, "WHERE": true, "WITH": true,
+}
+
+func next(s string, i int) byte {
+	if i+1 < len(s) {
+		return s[i+1]
+	}
+	return 0
+}
+
+// quotedEnd returns the index after the quoted text starting at s[i]. The
+// quote is escaped by doubling it, or also with a backslash.
+func quotedEnd(s string, i int, backslash bool) int {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if backslash {
+				j++
+			}
+		case quote:
+			if next(s, j) != quote {
+				return j + 1
+			}
+			j++
+		}
+	}
+	return len(s)
+}
+
+// stringEnd returns the index after the string literal starting at s[i],
+// like quotedEnd. Generic strings whose end depends on backslash escapes run
+// to the end of s, so that nothing following an escaped quote is recorded.
+func stringEnd(s string, i int, backslash bool, dialect Dialect) int {
+	end := quotedEnd(s, i, backslash)
+	if dialect == Generic && !backslash && quotedEnd(s, i, true) != end {
+		return len(s)
+	}
+	return end
+}
+
+// commentEnd returns the index after the block comment starting at s[i].
+func commentEnd(s string, i int, nested bool) int {
+	depth := 0
+	for j := i; j < len(s)-1; j++ {
+		switch {
+		case s[j] == '/' && s[j+1] == '*':
+			if depth == 0 || nested {
+				depth++
+			}
+			j++
+		case s[j] == '*' && s[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// dollarQuotedEnd returns the index after the Postgres $tag$ string starting
+// at s[i], and false when s[i] does not start one.
+func dollarQuotedEnd(s string, i int) (int, bool) {
+	j := i + 1
+	for j < len(s) && isWord(s[j]) && s[j] != '$' {
+		j++
+	}
+	if j >= len(s) || s[j] != '$' {
+		return 0, false
+	}
+	tag := s[i : j+1]
+	if end := strings.Index(s[j+1:], tag); end >= 0 {
+		return j + 1 + end + len(tag), true
+	}
+	return len(s), true
+}
+
+func numberEnd(s string, i int) int {
+	if s[i] == '0' && (next(s, i) == 'x' || next(s, i) == 'X') {
+		j := i + 2
+		for j < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+			j++
+		}
+		return j
+	}
+	j := i
+	for j < len(s) && (isDigit(s[j]) || s[j] == '.') {
+		j++
+	}
+	if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+		k := j + 1
+		if k < len(s) && (s[k] == '+' || s[k] == '-') {
+			k++
+		}
+		if k < len(s) && isDigit(s[k]) {
+			for j = k; j < len(s) && isDigit(s[j]); j++ {
+			}
+		}
+	}
+	return j
+}
+
+// unary reports whether a minus sign following tokens negates a number
+// rather than subtracting from an operand.
+func unary(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	prev := tokens[len(tokens)-1]
+	switch prev.kind {
+	case tokenPunct:
+		return prev.text != ")"
+	case tokenWord:
+		return keywords[strings.ToUpper(prev.text)]
+	}
+	return false
+}
+
+func isOperatorPair(a, b byte) bool {
+	switch string([]byte{a, b}) {
+	case "<=", ">=", "<>", "!=", "||", "::", "->", "=>":
+		return true
+	}
+	return false
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isWordStart(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch >= 0x80
+}
+
+func isWord(ch byte) bool {
+	return isWordStart(ch) || isDigit(ch) || ch == '$'
+}
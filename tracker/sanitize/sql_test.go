@@ -0,0 +1,72 @@
+package sanitize
+
+import "testing"
+
+func TestSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{"generic literals", Generic, "SELECT * FROM users WHERE name = 'alice' AND age > 30", "SELECT * FROM users WHERE name = ? AND age > ?"},
+		{"generic doubled quote", Generic, "SELECT 1 FROM t WHERE s = 'it''s' AND x = 1", "SELECT ? FROM t WHERE s = ? AND x = ?"},
+		{"generic ambiguous backslash", Generic, `SELECT * FROM t WHERE token = 'abc\' OR secret_value_123' AND x = 1`, "SELECT * FROM t WHERE token = ?"},
+		{"generic harmless backslash", Generic, `SELECT * FROM t WHERE path = 'C:\tmp' AND x = 1`, "SELECT * FROM t WHERE path = ? AND x = ?"},
+		{"generic escape string", Generic, `SELECT E'a\'b' AS s, 2`, "SELECT ? AS s, ?"},
+		{"generic unterminated", Generic, "SELECT * FROM t WHERE password = 'hunter2", "SELECT * FROM t WHERE password = ?"},
+		{"generic identifiers", Generic, `SELECT "name", ` + "`age`" + ` FROM t`, `SELECT "name", ` + "`age`" + ` FROM t`},
+		{"generic comments", Generic, "SELECT 1 -- secret 'x'\nFROM t /* token 'y' */ WHERE a = $1", "SELECT ? FROM t WHERE a = $1"},
+		{"generic unterminated comment", Generic, "SELECT a FROM t /* 'secret", "SELECT a FROM t"},
+
+		{"postgres standard string", Postgres, `SELECT * FROM t WHERE path = 'C:\' AND x = 1`, "SELECT * FROM t WHERE path = ? AND x = ?"},
+		{"postgres escape string", Postgres, `SELECT * FROM t WHERE s = E'it\'s secret' AND x = 1`, "SELECT * FROM t WHERE s = ? AND x = ?"},
+		{"postgres dollar quoting", Postgres, "SELECT $$it's 'secret'$$, $body$x$$y$body$ FROM t WHERE a = $1", "SELECT ?, ? FROM t WHERE a = $1"},
+		{"postgres unterminated dollar quoting", Postgres, "SELECT $tag$secret FROM t", "SELECT ?"},
+		{"postgres nested comment", Postgres, "SELECT /* a /* 'b' */ 'c' */ 1", "SELECT ?"},
+		{"postgres cast", Postgres, "SELECT '42'::int, -7", "SELECT ?::int, ?"},
+
+		{"mysql backslash escape", MySQL, `SELECT * FROM t WHERE token = 'abc\' OR secret_value_123' AND x = 1`, "SELECT * FROM t WHERE token = ? AND x = ?"},
+		{"mysql double-quoted string", MySQL, `SELECT * FROM t WHERE name = "alice" AND ` + "`id`" + ` = 3`, "SELECT * FROM t WHERE name = ? AND `id` = ?"},
+		{"mysql hash comment", MySQL, "SELECT 1 # 'secret'\nFROM t", "SELECT ? FROM t"},
+		{"mysql hex and binary", MySQL, "SELECT X'0f', b'1010', 0x1F", "SELECT ?, ?, ?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SQL(tt.query, tt.dialect); got != tt.want {
+				t.Errorf("SQL(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"select * from users where id in (1, 2, 3) -- admin", "SELECT * FROM users WHERE id IN (?)"},
+		{"insert into t (a, b) values (1, 'x'), (2, 'y');", "INSERT INTO t(a, b) VALUES (?)"},
+		{"SELECT count(*) FROM t WHERE a = $1 AND b = :name", "SELECT count(*) FROM t WHERE a = ? AND b = ?"},
+	}
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query, Generic); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestOperation(t *testing.T) {
+	tests := map[string]string{
+		"select 1":                       "SELECT",
+		"  (SELECT 1) UNION SELECT 2":    "SELECT",
+		"-- comment\nupdate t set a = 1": "UPDATE",
+		"'x'":                            "",
+		"":                               "",
+	}
+	for query, want := range tests {
+		if got := Operation(query); got != want {
+			t.Errorf("Operation(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
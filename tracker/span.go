@@ -0,0 +1,87 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ActiveTracerProvider returns the provider installed by Track, or the global
+// one when traces are paused or Track has not been called.
+func ActiveTracerProvider() trace.TracerProvider {
+	if c := activeConfig.Load(); c != nil && c.Tp != nil {
+		return c.Tp
+	}
+	return otel.GetTracerProvider()
+}
+
+// tracer returns the tracker's tracer.
+func tracer() trace.Tracer {
+	return ActiveTracerProvider().Tracer(instrumentationName, trace.WithInstrumentationVersion(instrumentationVersion()))
+}
+
+// StartSpan starts a span named name as a child of the span in ctx, using the
+// tracker's provider. The caller must End the returned span.
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return startSpan(ctx, name, 1, opts)
+}
+
+// Trace runs fn in a span named name. An error returned by fn is recorded
+// with ErrorRecording. A panic in fn is recorded on the span, which is ended,
+// and then re-panicked.
+func Trace(ctx context.Context, name string, fn func(ctx context.Context) error, opts ...trace.SpanStartOption) error {
+	_, err := traceValue(ctx, name, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, opts)
+	return err
+}
+
+// TraceValue is like Trace for functions that also return a value.
+func TraceValue[T any](ctx context.Context, name string, fn func(ctx context.Context) (T, error), opts ...trace.SpanStartOption) (T, error) {
+	return traceValue(ctx, name, fn, opts)
+}
+
+// traceValue implements Trace and TraceValue. It must be called directly by
+// them so that the code location skips the same number of frames.
+func traceValue[T any](ctx context.Context, name string, fn func(ctx context.Context) (T, error), opts []trace.SpanStartOption) (T, error) {
+	ctx, span := startSpan(ctx, name, 2, opts)
+	// Deferred so that the span also ends when fn calls runtime.Goexit. The
+	// closure stops the SDK's End from recovering the panic and recording it
+	// a second time.
+	defer func() { span.End() }()
+	defer func() {
+		if r := recover(); r != nil {
+			// A nested Trace already recorded it on its own span.
+			if panicStateFor(r).recorded.CompareAndSwap(false, true) {
+				recordPanic(span, r, debug.Stack())
+			} else {
+				span.SetStatus(codes.Error, fmt.Sprintf("panic: %v", r))
+			}
+			panic(r)
+		}
+	}()
+
+	v, err := fn(ctx)
+	ErrorRecording(ctx, err)
+	return v, err
+}
+
+// recordPanic adds an exception event for a recovered panic value and marks
+// the span as failed.
+func recordPanic(span trace.Span, r any, stack []byte) {
+	message := fmt.Sprint(r)
+	span.AddEvent("exception",
+		trace.WithAttributes(
+			attribute.String("exception.type", fmt.Sprintf("%T", r)),
+			attribute.String("exception.message", message),
+			attribute.String("exception.stacktrace", string(stack)),
+			attribute.Bool("exception.escaped", true),
+		),
+	)
+	span.SetStatus(codes.Error, "panic: "+message)
+}
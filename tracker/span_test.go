@@ -0,0 +1,163 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withActiveConfig makes c, with a tracer provider recording into the
+// returned exporter, the active config until the end of the test.
+func withActiveConfig(t *testing.T, c *Config, opts ...sdktrace.TracerProviderOption) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	c.Tp = sdktrace.NewTracerProvider(append(opts, sdktrace.WithSyncer(exporter))...)
+	activeConfig.Store(c)
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	return exporter
+}
+
+func spanEvents(span tracetest.SpanStub, name string) []sdktrace.Event {
+	var events []sdktrace.Event
+	for _, event := range span.Events {
+		if event.Name == name {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestStartSpan(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{})
+	ctx, parent := StartSpan(context.Background(), "parent")
+	_, child := StartSpan(ctx, "child", trace.WithSpanKind(trace.SpanKindClient))
+	child.End()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("span %q is not a child of the parent span", spans[0].Name)
+	}
+	if spans[0].SpanKind != trace.SpanKindClient {
+		t.Errorf("span kind = %v, want client", spans[0].SpanKind)
+	}
+	if got := spans[0].InstrumentationLibrary.Name; got != instrumentationName {
+		t.Errorf("instrumentation scope = %q, want %q", got, instrumentationName)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{})
+	errFailed := errors.New("payment declined")
+	tests := []struct {
+		name   string
+		err    error
+		status codes.Code
+	}{
+		{"success", nil, codes.Unset},
+		{"failure", errFailed, codes.Error},
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		var inner trace.SpanContext
+		err := Trace(context.Background(), tt.name, func(ctx context.Context) error {
+			inner = trace.SpanContextFromContext(ctx)
+			return tt.err
+		})
+		if err != tt.err {
+			t.Errorf("%s: Trace() = %v, want %v", tt.name, err, tt.err)
+		}
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("%s: got %d spans, want 1", tt.name, len(spans))
+		}
+		span := spans[0]
+		if span.SpanContext.SpanID() != inner.SpanID() {
+			t.Errorf("%s: fn did not run in the span", tt.name)
+		}
+		if span.Status.Code != tt.status {
+			t.Errorf("%s: status = %v, want %v", tt.name, span.Status, tt.status)
+		}
+		if got, want := len(spanEvents(span, "exception")), map[bool]int{true: 1}[tt.err != nil]; got != want {
+			t.Errorf("%s: got %d exception events, want %d", tt.name, got, want)
+		}
+	}
+}
+
+func TestTraceValue(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{})
+	v, err := TraceValue(context.Background(), "lookup", func(context.Context) (int, error) {
+		return 42, nil
+	})
+	if v != 42 || err != nil {
+		t.Errorf("TraceValue() = %d, %v, want 42, nil", v, err)
+	}
+	errMissing := errors.New("missing")
+	v, err = TraceValue(context.Background(), "lookup", func(context.Context) (int, error) {
+		return 7, errMissing
+	})
+	if v != 7 || err != errMissing {
+		t.Errorf("TraceValue() = %d, %v, want 7 and the error of fn", v, err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Status.Code != codes.Unset || spans[1].Status.Code != codes.Error {
+		t.Errorf("got spans %v, want an unset and a failed span", spans)
+	}
+}
+
+func TestTracePanic(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{})
+	boom := errors.New("boom")
+	var recovered any
+	func() {
+		defer func() { recovered = recover() }()
+		_ = Trace(context.Background(), "charge", func(context.Context) error {
+			panic(boom)
+		})
+	}()
+	if recovered != boom {
+		t.Fatalf("recovered %v, want the original panic value", recovered)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want the ended span", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error || spans[0].Status.Description != "panic: boom" {
+		t.Errorf("status = %v, want an error for the panic", spans[0].Status)
+	}
+	events := spanEvents(spans[0], "exception")
+	if len(events) != 1 {
+		t.Fatalf("got %d exception events, want 1", len(events))
+	}
+	for _, kv := range events[0].Attributes {
+		if kv.Key == "exception.escaped" && !kv.Value.AsBool() {
+			t.Error("exception.escaped = false, want true")
+		}
+	}
+}
+
+// The span must end when fn stops its goroutine, e.g. with t.FailNow.
+func TestTraceGoexit(t *testing.T) {
+	exporter := withActiveConfig(t, &Config{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = Trace(context.Background(), "exit", func(context.Context) error {
+			runtime.Goexit()
+			return nil
+		})
+	}()
+	<-done
+	if got := len(exporter.GetSpans()); got != 1 {
+		t.Errorf("got %d ended spans, want 1", got)
+	}
+}
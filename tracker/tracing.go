@@ -4,10 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 
 	goErros "github.com/go-errors/errors"
-	"go.opentelemetry.io/contrib/propagators/b3"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -18,7 +16,6 @@ import (
 	"log"
 	"time"
 
-	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
@@ -66,53 +63,17 @@ func (t *Traces) initTraces(ctx context.Context, c *Config) error {
 		attribute.String("mw_serverless", c.isServerless),
 	}
 
-	for key, value := range c.customResourceAttributes {
-		switch v := value.(type) {
-		case string:
-			attributes = append(attributes, attribute.String(key, v))
-		case bool:
-			attributes = append(attributes, attribute.Bool(key, v))
-		case int:
-			attributes = append(attributes, attribute.Int(key, v)) // handle int
-		case int64:
-			attributes = append(attributes, attribute.Int64(key, v)) // handle int64
-		case float64:
-			attributes = append(attributes, attribute.Float64(key, v)) // handle float64
-		case float32:
-			attributes = append(attributes, attribute.Float64(key, float64(v))) // cast float32 to float64
-		case []string:
-			for _, s := range v {
-				attributes = append(attributes, attribute.String(key, s)) // handle []string by appending each string
-			}
-		case []int:
-			for _, i := range v {
-				attributes = append(attributes, attribute.Int(key, i)) // handle []int by appending each int
-			}
-		case []float64:
-			for _, f := range v {
-				attributes = append(attributes, attribute.Float64(key, f)) // handle []float64 by appending each float64
-			}
-		default:
-			fmt.Printf("Unsupported attribute type for key: %s\n", key)
-		}
-	}
-	
-	// Get the MW_CUSTOM_RESOURCE_ATTRIBUTES environment variable
-	envResourceAttributes := os.Getenv("MW_CUSTOM_RESOURCE_ATTRIBUTES")
-	// Split the attributes by comma
-	attrs := strings.Split(envResourceAttributes, ",")
-	for _, attr := range attrs {
-		// Split each attribute by the '=' character
-		kv := strings.SplitN(attr, "=", 2)
-		if len(kv) == 2 {
-			key := strings.TrimSpace(kv[0])
-			value := strings.TrimSpace(kv[1])
-			attributes = append(attributes, attribute.String(key, value))
-		}
-	}
+	// Adding custom resource attributes from the config and MW_CUSTOM_RESOURCE_ATTRIBUTES
+	attributes = addCustomResourceAttributes(attributes, c)
+
+	// Adding VCS information and service version to the resource attributes
+	attributes = addVCSAttributes(attributes, c)
 
-	// Adding VCS information to the resource attributes
-	attributes = addVCSAttributes(attributes)
+	// Adding container and Kubernetes information to the resource attributes
+	attributes = addContainerAttributes(attributes, c)
+
+	// Adding cloud platform information to the resource attributes
+	attributes = addCloudAttributes(attributes, c)
 	
 	resources, err := resource.New(
 		context.Background(),
@@ -125,30 +86,24 @@ func (t *Traces) initTraces(ctx context.Context, c *Config) error {
 		log.Println("failed to set resources for traces:", err)
 	}
 
+	providerOptions := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resources),
+		sdktrace.WithSampler(debugSampler{base: samplerFromEnv()}),
+		sdktrace.WithSpanProcessor(ContextAttributesSpanProcessor{}),
+	}
+	if len(c.baggageKeys) > 0 {
+		providerOptions = append(providerOptions, sdktrace.WithSpanProcessor(NewBaggageSpanProcessor(c.baggageKeys...)))
+	}
+	providerOptions = append(providerOptions,
+		sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter,
+			sdktrace.WithMaxExportBatchSize(10000), sdktrace.WithBatchTimeout(10*time.Second))),
+	)
 	if c.debug {
-		TraceProvider = *sdktrace.NewTracerProvider(
-			sdktrace.WithResource(resources),
-			sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter,
-				sdktrace.WithMaxExportBatchSize(10000), sdktrace.WithBatchTimeout(10*time.Second))),
-			sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(consoleExporter)),
-		)
-	} else {
-		TraceProvider = *sdktrace.NewTracerProvider(
-			sdktrace.WithResource(resources),
-			sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter,
-				sdktrace.WithMaxExportBatchSize(10000), sdktrace.WithBatchTimeout(10*time.Second))),
-		)
+		providerOptions = append(providerOptions, sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(consoleExporter)))
 	}
+	TraceProvider = *sdktrace.NewTracerProvider(providerOptions...)
 	otel.SetTracerProvider(&TraceProvider)
 	c.Tp = &TraceProvider
-
-	p := b3.New()
-	otel.SetTextMapPropagator(
-		propagation.NewCompositeTextMapPropagator(
-			p,
-			propagation.TraceContext{},
-			propagation.Baggage{}),
-	)
 	return err
 }
 
@@ -181,17 +136,45 @@ func ErrorCode() codes.Code {
 	return codes.Error
 }
 
-func ErrorRecording(ctx context.Context, err error) {
+// ErrorRecording records err on the span in ctx: one "exception" event for
+// err and one for each error it wraps or joins, and an error status. The
+// exception type is the concrete type of each error and the stack trace the
+// one captured when the error was created, if it carries one.
+func ErrorRecording(ctx context.Context, err error, opts ...ErrorOption) {
+	if err == nil {
+		return
+	}
+	var cfg errorConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 	span := trace.SpanFromContext(ctx)
-	if err != nil {
-		errorStack := string(goErros.Wrap(err, 3).Stack())
-		span.AddEvent("exception",
-			trace.WithAttributes(
-				attribute.String("exception.type", "*errors.errorString"),
-				attribute.String("exception.stacktrace", errorStack),
-				attribute.String("exception.message", err.Error()),
-			),
-		)
+
+	if !cfg.skipEvents {
+		for i, cause := range errorCauses(err) {
+			attributes := []attribute.KeyValue{
+				attribute.String("exception.type", errorType(cause)),
+				attribute.String("exception.message", cause.Error()),
+			}
+			if i == 0 {
+				stack, ok := creationStack(err)
+				if !ok {
+					stack = string(goErros.Wrap(err, 3).Stack())
+				}
+				attributes = append(attributes, attribute.String("exception.stacktrace", stack))
+				attributes = append(attributes, errorAttributes(err, true)...)
+				attributes = append(attributes, cfg.attributes...)
+			} else {
+				if stack, ok := errorStack(cause); ok {
+					attributes = append(attributes, attribute.String("exception.stacktrace", stack))
+				}
+				attributes = append(attributes, attribute.Int("exception.cause_index", i))
+				attributes = append(attributes, errorAttributes(cause, false)...)
+			}
+			span.AddEvent("exception", trace.WithAttributes(attributes...))
+		}
+	}
+	if !cfg.skipStatus {
 		span.SetStatus(codes.Error, err.Error())
 	}
 }
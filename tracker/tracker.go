@@ -4,9 +4,13 @@ import (
 	"context"
 	"log"
 	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 
 	"github.com/middleware-labs/golang-apm/logger"
 
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
@@ -14,15 +18,46 @@ import (
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	"time"
-	"strings"
 )
 
 
+// instrumentationName is the instrumentation scope used for telemetry the
+// tracker produces itself.
+const instrumentationName = "github.com/middleware-labs/golang-apm/tracker"
+
+// activeConfig is the configuration of the most recent Track call, used by
+// the package level helpers.
+var activeConfig atomic.Pointer[Config]
+
+// instrumentationVersion is the version of this module as recorded in the
+// build info of the binary, or "devel" when unknown.
+var instrumentationVersion = sync.OnceValue(func() string {
+	const modulePath = "github.com/middleware-labs/golang-apm"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == modulePath && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			return bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == modulePath {
+				if dep.Replace != nil && dep.Replace.Version != "" {
+					return dep.Replace.Version
+				}
+				return dep.Version
+			}
+		}
+	}
+	return "devel"
+})
+
 func TrackWithCtx(ctx context.Context, opts ...Options) (*Config, error) {
 
-	c := newConfig(opts...)
+	c := newConfig(ctx, opts...)
 	logger.InitLogger(c.ServiceName, c.AccessToken, c.fluentHost, c.isServerless)
 
+	if !c.skipGlobalPropagator {
+		otel.SetTextMapPropagator(c.propagator)
+	}
+
 	if !c.pauseTraces {
 		tracesHandler := Traces{}
 		errTraces := tracesHandler.initTraces(ctx, c)
@@ -37,8 +72,13 @@ func TrackWithCtx(ctx context.Context, opts ...Options) (*Config, error) {
 		if errLogs != nil {
 			log.Println("failed to track logs: ", errLogs)
 		}
+		if !c.pauseDeploymentMarker {
+			emitDeploymentMarker(ctx, c)
+		}
 	}
 
+	activeConfig.Store(c)
+
 	if !c.pauseMetrics {
 		metricsHandler := Metrics{}
 		go func() {
@@ -88,117 +128,26 @@ func NewTracerProviderCtx(ctx context.Context, c *Config, serviceName string) *t
 		}
 	}
 
+	attributes := []attribute.KeyValue{
+		attribute.String("service.name", serviceName),
+		attribute.String("telemetry.sdk.language", "go"),
+		attribute.Bool("mw_agent", true),
+		attribute.String("project.name", c.projectName),
+		attribute.String("mw.account_key", c.AccessToken),
+		attribute.String("mw_serverless", c.isServerless),
+	}
+
+	// Adding custom resource attributes from the config and MW_CUSTOM_RESOURCE_ATTRIBUTES
+	attributes = addCustomResourceAttributes(attributes, c)
+
 	res, err := resource.New(context.Background(),
 		resource.WithAttributes(
-			attribute.String("service.name", serviceName),
-			attribute.String("telemetry.sdk.language", "go"),
-			attribute.Bool("mw_agent", true),
-			attribute.String("project.name", c.projectName),
-			attribute.String("mw.account_key", c.AccessToken),
-			attribute.String("mw_serverless", c.isServerless),
-	
+			attributes...,
 		),
 	)
-	
-	for key, value := range c.customResourceAttributes {
-		switch v := value.(type) {
-		case string:
-			res, err = resource.Merge(res, resource.NewSchemaless(
-				attribute.String(key, v),
-			))
-			if err != nil {
-				log.Println("failed to create resource: %v", err)
-			}
-		case bool:
-			res, err = resource.Merge(res, resource.NewSchemaless(
-				attribute.Bool(key, v),
-			))
-			if err != nil {
-				log.Println("failed to create resource: %v", err)
-			}
-		case int:
-			res, err = resource.Merge(res, resource.NewSchemaless(
-				attribute.Int(key, v),
-			))
-			if err != nil {
-				log.Println("failed to create resource: %v", err)
-			}
-
-		case int64:
-			res, err = resource.Merge(res, resource.NewSchemaless(
-				attribute.Int64(key, v),
-			))
-			if err != nil {
-				log.Println("failed to create resource: %v", err)
-			}
-		case float64:
-			res, err = resource.Merge(res, resource.NewSchemaless(
-				attribute.Float64(key, v),
-			))
-			if err != nil {
-				log.Println("failed to create resource: %v", err)
-			}
-
-		case float32:
-			res, err = resource.Merge(res, resource.NewSchemaless(
-				attribute.Float64(key, float64(v)),
-			))
-			if err != nil {
-				log.Println("failed to create resource: %v", err)
-			}
-
-		case []string:
-			for _, s := range v {
-				res, err = resource.Merge(res, resource.NewSchemaless(
-					attribute.String(key, s),
-				))
-				if err != nil {
-					log.Println("failed to create resource: %v", err)
-				}
-			}
-		case []int:
-			for _, i := range v {
-				res, err = resource.Merge(res, resource.NewSchemaless(
-					attribute.Int(key, i),
-				))
-				if err != nil {
-					log.Println("failed to create resource: %v", err)
-				}
-			}
-		case []float64:
-			for _, f := range v {
-				res, err = resource.Merge(res, resource.NewSchemaless(
-					attribute.Float64(key, f),
-				))
-				if err != nil {
-					log.Println("failed to create resource: %v", err)
-				}
-			}
-		default:
-			log.Printf("Unsupported attribute type for key: %s\n", key)
-		}
-	}
-	
-	// Get the MW_CUSTOM_RESOURCE_ATTRIBUTES environment variable
-	envResourceAttributes := os.Getenv("MW_CUSTOM_RESOURCE_ATTRIBUTES")
-	// Split the attributes by comma
-	attrs := strings.Split(envResourceAttributes, ",")
-	for _, attr := range attrs {
-		// Split each attribute by the '=' character
-		kv := strings.SplitN(attr, "=", 2)
-		if len(kv) == 2 {
-			key := strings.TrimSpace(kv[0])
-			value := strings.TrimSpace(kv[1])
-			res, err = resource.Merge(res, resource.NewSchemaless(
-				attribute.String(key, value),
-			))
-			if err != nil {
-				log.Println("failed to create resource: %v", err)
-			}
-		}
+	if err != nil {
+		log.Println("failed to create resource: ", err)
 	}
-	
-	
 
 	var tp *trace.TracerProvider
 